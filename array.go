@@ -0,0 +1,87 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/couchbase/query/errors"
+)
+
+/* The array formatter writes the results as a single JSON array,
+   with each result on its own line, as soon as it is read. It is
+   used by \EXPORT, so that the file can be read as one JSON
+   document. The errors and warnings are listed on os.Stderr, and
+   the status and metrics are not written.
+*/
+type ArrayFormatter struct {
+	w    io.Writer
+	rows int
+}
+
+func NewArrayFormatter(w io.Writer) Formatter {
+	return &ArrayFormatter{w: w}
+}
+
+func (this *ArrayFormatter) Header(requestID string, signature json.RawMessage) (int, string) {
+	return 0, ""
+}
+
+func (this *ArrayFormatter) Row(row []byte) (int, string) {
+	var buf bytes.Buffer
+	if this.rows == 0 {
+		buf.WriteString("[\n")
+	} else {
+		buf.WriteString(",\n")
+	}
+	this.rows++
+
+	if err := json.Compact(&buf, row); err != nil {
+		return errors.JSON_UNMARSHAL, err.Error()
+	}
+
+	_, werr := this.w.Write(buf.Bytes())
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
+
+func (this *ArrayFormatter) Messages(errs, warnings json.RawMessage) (int, string) {
+	for _, line := range messageLines(errs, warnings) {
+		if _, werr := io.WriteString(os.Stderr, line+"\n"); werr != nil {
+			return errors.WRITER_OUTPUT, werr.Error()
+		}
+	}
+	return 0, ""
+}
+
+func (this *ArrayFormatter) Status(status string) (int, string) {
+	return 0, ""
+}
+
+func (this *ArrayFormatter) Metrics(metrics []byte) (int, string) {
+	return 0, ""
+}
+
+func (this *ArrayFormatter) End() (int, string) {
+	end := "\n]\n"
+	if this.rows == 0 {
+		end = "[]\n"
+	}
+	_, werr := io.WriteString(this.w, end)
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
@@ -0,0 +1,203 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* \SET and \PUSH can store the results of a statement in a user
+   defined session variable or named parameter :
+       \SET $count = (SELECT RAW COUNT(*) FROM b);
+   stores the result itself when the statement returns a single
+   result, and the results array otherwise. A result can also be
+   chosen by its index, as in
+       \SET $name = (SELECT RAW name FROM b)[2];
+   which stores null when the index is past the end of the
+   results, and
+       \SET $ids = (SELECT RAW id FROM b)[*];
+   always stores the results array, even when it holds a single
+   result.
+*/
+var captureCmd = regexp.MustCompile(`(?is)^\\(set|push)\s+(-?\$[^\s=]+)\s*=\s*\((.*)\)\s*(\[\s*(\d+|\*)\s*\])?$`)
+
+/* If the input is a \SET or \PUSH of the results of a statement,
+   run the statement and store its results. The first return value
+   is false if the input is not of this form.
+*/
+func captureResults(line string) (bool, int, string) {
+	m := captureCmd.FindStringSubmatch(line)
+	if m == nil {
+		return false, 0, ""
+	}
+
+	set := strings.ToLower(m[1]) == "set"
+	name := m[2]
+
+	results, err_code, err_str := QueryResults(m[3])
+	if err_code != 0 {
+		return true, err_code, err_str
+	}
+
+	val, err_code, err_str := captureValue(results, m[4] != "", m[5])
+	if err_code != 0 {
+		return true, err_code, err_str
+	}
+
+	err_code, err_str = command.PushOrSetValue(name, val, set)
+	return true, err_code, err_str
+}
+
+/* Return the value to store for the results array of a captured
+   statement. Without an index a single result is unwrapped; index
+   * keeps the array, and a number picks one result.
+*/
+func captureValue(results value.Value, indexed bool, index string) (value.Value, int, string) {
+	if !indexed {
+		if array, ok := results.Actual().([]interface{}); ok && len(array) == 1 {
+			return value.NewValue(array[0]), 0, ""
+		}
+		return results, 0, ""
+	}
+
+	if index == "*" {
+		return results, 0, ""
+	}
+
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return nil, command.INVALID_ARG_VALUE, "result index : " + index
+	}
+
+	val, ok := results.Index(i)
+	if !ok {
+		val = value.NewValue(nil)
+	}
+	return val, 0, ""
+}
+
+/* Run the statement and return its results as an array value,
+   without writing anything to the output. If the query service
+   returns errors, they are written instead, and SERVER_ERRORS is
+   returned.
+*/
+func QueryResults(line string) (value.Value, int, string) {
+	if NoQueryService == true {
+		//Not connected to a query service
+		return nil, errors.NO_CONNECTION, ""
+	}
+
+	stmt, err_code, err_str := Interpolate(line)
+	if err_code != 0 {
+		return nil, err_code, err_str
+	}
+
+	n1ql, err := sql.Open("n1ql", ServerFlag)
+	if err != nil {
+		return nil, errors.GO_N1QL_OPEN, ""
+	}
+
+	rows, err := n1ql.Query(stmt)
+	if err != nil {
+		// List the errors returned by the query service readably.
+		if response, ok := parseQueryError(err.Error()); ok {
+			err_code, err_str := writeCaptureErrors(response.Errors, response.Warnings)
+			return nil, err_code, err_str
+		}
+		return nil, errors.GON1QL_QUERY, err.Error()
+	}
+
+	columns, _ := rows.Columns()
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+
+	var buf bytes.Buffer
+	buf.WriteString("[")
+
+	rownum := 0
+	var order []int
+	var meta map[string]json.RawMessage
+	for rows.Next() {
+		for i, _ := range columns {
+			valuePtrs[i] = &values[i]
+		}
+
+		result, err_code, err_str := ScanRow(rows, columns, values, valuePtrs, rownum, order)
+		if err_code != 0 {
+			rows.Close()
+			return nil, err_code, err_str
+		}
+
+		// Keep the columns in the order they were projected.
+		if rownum == 0 {
+			_, meta, _ = decodeObject(result)
+			order = columnOrder(columns, meta["signature"])
+		}
+
+		// The first two rows are the metadata and the metrics.
+		if rownum > 1 {
+			if buf.Len() > 1 {
+				buf.WriteString(",")
+			}
+			buf.Write(result)
+		}
+		rownum++
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, errors.ROWS_CLOSE, err.Error()
+	}
+
+	if hasMessages(meta["errors"]) {
+		err_code, err_str := writeCaptureErrors(meta["errors"], meta["warnings"])
+		return nil, err_code, err_str
+	}
+
+	// Dont store the partial results of a statement that was stopped.
+	var status string
+	json.Unmarshal(meta["status"], &status)
+	if status != "" && status != "success" {
+		return nil, errors.GON1QL_QUERY, "status : " + status
+	}
+
+	buf.WriteString("]")
+	return value.NewValue(buf.Bytes()), 0, ""
+}
+
+/* Write the errors and warnings returned for a statement whose
+   results are being stored, as printExecError would, and return
+   SERVER_ERRORS with the errors so that they are not written
+   again.
+*/
+func writeCaptureErrors(errs, warnings json.RawMessage) (int, string) {
+	lines := strings.Join(messageLines(errs, warnings), "\n")
+	_, werr := io.WriteString(command.W, fmt.Sprintln(fgRed, lines, reset)+"\n")
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+
+	compact, err_code, err_str := compactJSON(errs)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	return command.SERVER_ERRORS, string(compact)
+}
@@ -0,0 +1,51 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/couchbase/query/value"
+)
+
+func TestCaptureValue(t *testing.T) {
+	tests := []struct {
+		line     string
+		results  string
+		expected string
+	}{
+		{`\SET $count = (SELECT RAW COUNT(*) FROM b);`, `[7303]`, `7303`},
+		{`\SET $ids = (SELECT RAW id FROM b);`, `["a","b"]`, `["a","b"]`},
+		{`\SET $ids = (SELECT RAW id FROM b);`, `[]`, `[]`},
+		{`\PUSH -$ids = (SELECT RAW id FROM b)[*];`, `["a"]`, `["a"]`},
+		{`\set $id = (SELECT RAW id FROM b) [ 1 ];`, `["a","b"]`, `"b"`},
+		{`\SET $id = (SELECT RAW id FROM b)[2];`, `["a","b"]`, `null`},
+	}
+
+	for _, test := range tests {
+		stmts := NewSplitter().Feed(test.line + "\n")
+		if len(stmts) != 1 {
+			t.Errorf("%s : split into %q", test.line, stmts)
+			continue
+		}
+		m := captureCmd.FindStringSubmatch(stmts[0].Text)
+		if m == nil {
+			t.Errorf("%s : not a capture", test.line)
+			continue
+		}
+
+		val, err_code, err_str := captureValue(value.NewValue([]byte(test.results)), m[4] != "", m[5])
+		if err_code != 0 {
+			t.Errorf("%s : error %d %s", test.line, err_code, err_str)
+		} else if got := val.String(); got != test.expected {
+			t.Errorf("%s : stored %s, expected %s", test.line, got, test.expected)
+		}
+	}
+}
@@ -10,9 +10,9 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"io"
 	"sort"
 	"strings"
@@ -29,6 +29,7 @@ returns an error code and optionally a non empty error message.
 func execute_input(line string, w io.Writer) (int, string) {
 
 	command.W = w
+	setColor(colorEnabled(w))
 
 	if DISCONNECT == true || NoQueryService == true {
 		if strings.HasPrefix(strings.ToLower(line), "\\connect") {
@@ -71,6 +72,12 @@ func execute_input(line string, w io.Writer) (int, string) {
 			//Not connected to a query service
 			return errors.NO_CONNECTION, ""
 		} else {
+			//Substitute the values of the session variables in the statement.
+			stmt, err_code, err_str := Interpolate(line)
+			if err_code != 0 {
+				return err_code, err_str
+			}
+
 			/* Try opening a connection to the endpoint. If successful, ping.
 			   If successful execute the n1ql command. Else try to connect
 			   again.
@@ -80,10 +87,25 @@ func execute_input(line string, w io.Writer) (int, string) {
 				return errors.GO_N1QL_OPEN, ""
 			} else {
 				//Successfully logged into the server
-				err_code, err_str := ExecN1QLStmt(line, n1ql, w)
+				pager, err_code, err_str := NewPager(w)
+				if err_code != 0 {
+					return err_code, err_str
+				}
+
+				limit, err_code, err_str := currentLimit()
+				if err_code != 0 {
+					return err_code, err_str
+				}
+				stmt = addLimit(stmt, limit)
+
+				err_code, err_str = ExecN1QLStmt(stmt, n1ql, pager, limit)
+				p_code, p_str := pager.Close()
 				if err_code != 0 {
 					return err_code, err_str
 				}
+				if p_code != 0 {
+					return p_code, p_str
+				}
 			}
 
 		}
@@ -92,24 +114,32 @@ func execute_input(line string, w io.Writer) (int, string) {
 	return 0, ""
 }
 
-func WriteHelper(rows *sql.Rows, columns []string, values, valuePtrs []interface{}, rownum int) ([]byte, int, string) {
+/* Scan the current row and return it as compact JSON. A column
+   with an empty value was MISSING in the result, and is left out
+   of the row, while a NULL column is kept as null, so that the
+   row is the same as the one sent by the server. If the only
+   column is MISSING then the row is an empty object. The columns
+   of a result are written in the given order, which is the order
+   of columns when nil.
+*/
+func ScanRow(rows *sql.Rows, columns []string, values, valuePtrs []interface{}, rownum int, order []int) ([]byte, int, string) {
 	//Scan the values into the respective columns
 	if err := rows.Scan(valuePtrs...); err != nil {
 		return nil, errors.ROWS_SCAN, err.Error()
 	}
 
-	dat := map[string]*json.RawMessage{}
+	dat := map[string]json.RawMessage{}
 	var c []byte = nil
 	var b []byte = nil
 	var err error = nil
 
 	for i, col := range columns {
-		var parsed *json.RawMessage
+		var parsed json.RawMessage
 
 		val := values[i]
 		b, _ := val.([]byte)
 
-		if string(b) != "" {
+		if len(bytes.TrimSpace(b)) != 0 {
 			//Parse the sub values of the main map first.
 			err = json.Unmarshal(b, &parsed)
 			if err != nil {
@@ -120,15 +150,13 @@ func WriteHelper(rows *sql.Rows, columns []string, values, valuePtrs []interface
 			dat[col] = parsed
 
 		} else {
+			// MISSING
 			continue
 		}
 
 		//Remove one level of nesting for the results when we have only 1 column to project.
 		if len(columns) == 1 {
-			c, err = dat[col].MarshalJSON()
-			if err != nil {
-				return nil, errors.JSON_MARSHAL, err.Error()
-			}
+			c = parsed
 		}
 
 	}
@@ -146,58 +174,150 @@ func WriteHelper(rows *sql.Rows, columns []string, values, valuePtrs []interface
 		}
 		sort.Strings(keys)
 
-		if keys != nil {
-			map_value := dat[keys[0]]
-			b, err = map_value.MarshalJSON()
-			if err != nil {
-				return nil, errors.JSON_MARSHAL, err.Error()
-			}
-
+		if len(keys) > 0 {
+			b = dat[keys[0]]
 		}
 
 	} else {
 		if len(columns) != 1 {
-			b, err = json.Marshal(dat)
+			b, err = marshalRow(columns, dat, order)
 			if err != nil {
 				return nil, errors.JSON_MARSHAL, err.Error()
 			}
-		} else {
+		} else if c != nil {
 			b = c
+		} else {
+			// The only column is MISSING, so the result is empty.
+			b = []byte("{}")
 		}
 
 	}
 
-	if *prettyFlag == true {
-		var data map[string]interface{}
-		if err := json.Unmarshal(b, &data); err != nil {
-			return nil, errors.JSON_UNMARSHAL, err.Error()
+	return b, 0, ""
+}
+
+/* Write the columns of a row as a JSON object, in the given
+   order. The columns that are not in the row are left out.
+*/
+func marshalRow(columns []string, dat map[string]json.RawMessage, order []int) ([]byte, error) {
+	if order == nil {
+		order = make([]int, len(columns))
+		for i, _ := range columns {
+			order[i] = i
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for _, i := range order {
+		val, ok := dat[columns[i]]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteString(",")
 		}
 
-		b, err = json.MarshalIndent(data, "        ", "    ")
+		key, err := json.Marshal(columns[i])
 		if err != nil {
-			return nil, errors.JSON_MARSHAL, err.Error()
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		if err := json.Compact(&buf, val); err != nil {
+			return nil, err
 		}
 	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
 
-	return b, 0, ""
+/* Return the order to write the columns of the results in. The
+   columns in the signature come first, in the order they were
+   projected, followed by the others in the order of columns.
+*/
+func columnOrder(columns []string, signature json.RawMessage) []int {
+	order := make([]int, 0, len(columns))
+	used := make([]bool, len(columns))
+
+	for _, name := range signatureColumns(signature) {
+		for i, col := range columns {
+			if col == name && !used[i] {
+				order = append(order, i)
+				used[i] = true
+				break
+			}
+		}
+	}
+	for i, _ := range columns {
+		if !used[i] {
+			order = append(order, i)
+		}
+	}
+	return order
 }
 
-func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer) (int, string) {
+/* Execute the N1QL statement and write its results using the
+   formatter for the current output format. If limit is not 0
+   then only that many results are written, followed by a note
+   if there were more. If the query service returns errors then
+   they are written with the results, and SERVER_ERRORS is
+   returned. Warnings are written as well, but are not treated as
+   errors.
+*/
+func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer, limit int) (int, string) {
 	//if strings.HasPrefix(strings.ToLower(line), "prepare") {
 
+	formatter, err_code, err_str := GetFormatter(currentFormat(), w)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	return execFormatted(line, n1ql, formatter, noteWriter(w), limit)
+}
+
+/* Execute the N1QL statement and write its results using the
+   given formatter, with the notes that follow the results, such
+   as the timings, written to note.
+*/
+func execFormatted(line string, n1ql *sql.DB, formatter Formatter, note io.Writer, limit int) (int, string) {
+	metricsMode, err_code, err_str := currentMetrics()
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	timingOn, err_code, err_str := currentTiming()
+	if err_code != 0 {
+		return err_code, err_str
+	}
+
+	timing := StartTiming()
 	rows, err := n1ql.Query(line)
 
 	if err != nil {
-		return errors.GON1QL_QUERY, err.Error()
+		timing.Done()
+		response, ok := parseQueryError(err.Error())
+		if !ok {
+			return errors.GON1QL_QUERY, err.Error()
+		}
+
+		err_code, err_str := writeQueryError(formatter, response, metricsMode)
+		if err_code != command.SERVER_ERRORS {
+			return err_code, err_str
+		}
+		if werr := writeTimingNotes(note, timing, 0, response.Metrics, metricsMode, timingOn); werr != nil {
+			return errors.WRITER_OUTPUT, werr.Error()
+		}
+		return err_code, err_str
 
 	} else {
-		iter := 0
 		rownum := 0
+		shown := 0
+		more := false
 
-		var werr error
 		status := ""
+		var errs, warnings json.RawMessage
 		var metrics []byte
 		metrics = nil
+		var order []int
 
 		// Multi column projection
 		columns, _ := rows.Columns()
@@ -205,9 +325,6 @@ func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer) (int, string) {
 		values := make([]interface{}, count)
 		valuePtrs := make([]interface{}, count)
 
-		//Check if spacing is enough
-		_, werr = io.WriteString(w, "\n{\n")
-
 		for rows.Next() {
 
 			for i, _ := range columns {
@@ -218,28 +335,31 @@ func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer) (int, string) {
 
 				// Get the first row to post process.
 
-				extras, err_code, err_string := WriteHelper(rows, columns, values, valuePtrs, rownum)
+				extras, err_code, err_string := ScanRow(rows, columns, values, valuePtrs, rownum, nil)
 
 				if extras == nil && err_code != 0 {
 					return err_code, err_string
 				}
 
-				var dat map[string]interface{}
+				var dat map[string]json.RawMessage
 
 				if err := json.Unmarshal(extras, &dat); err != nil {
 					return errors.JSON_UNMARSHAL, err.Error()
 				}
 
-				_, werr = io.WriteString(w, "    \"requestID\": \""+dat["requestID"].(string)+"\",\n")
+				var requestID string
+				json.Unmarshal(dat["requestID"], &requestID)
+				json.Unmarshal(dat["status"], &status)
+				errs = dat["errors"]
+				warnings = dat["warnings"]
 
-				jsonString, err := json.MarshalIndent(dat["signature"], "        ", "    ")
+				// Write the columns in the order they were projected.
+				order = columnOrder(columns, dat["signature"])
 
-				if err != nil {
-					return errors.JSON_MARSHAL, err.Error()
+				err_code, err_string = formatter.Header(requestID, dat["signature"])
+				if err_code != 0 {
+					return err_code, err_string
 				}
-				_, werr = io.WriteString(w, "    \"signature\": "+string(jsonString)+",\n")
-				_, werr = io.WriteString(w, "    \"results\" : [\n\t")
-				status = dat["status"].(string)
 				rownum++
 				continue
 			}
@@ -250,7 +370,7 @@ func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer) (int, string) {
 
 				var err_code int
 				var err_string string
-				metrics, err_code, err_string = WriteHelper(rows, columns, values, valuePtrs, rownum)
+				metrics, err_code, err_string = ScanRow(rows, columns, values, valuePtrs, rownum, nil)
 
 				if metrics == nil && err_code != 0 {
 					return err_code, err_string
@@ -261,18 +381,22 @@ func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer) (int, string) {
 				continue
 			}
 
-			if iter == 0 {
-				iter++
-			} else {
-				_, werr = io.WriteString(w, ", \n\t")
+			result, err_code, err_string := ScanRow(rows, columns, values, valuePtrs, rownum, order)
+			if err_code != 0 {
+				return err_code, err_string
 			}
 
-			result, err_code, err_string := WriteHelper(rows, columns, values, valuePtrs, rownum)
-			if result == nil && err_code != 0 {
-				return err_code, err_string
+			// Stop reading once there are known to be more results.
+			if limit > 0 && shown >= limit {
+				more = true
+				break
 			}
+			shown++
 
-			_, werr = io.WriteString(w, string(result))
+			err_code, err_string = formatter.Row(result)
+			if err_code != 0 {
+				return err_code, err_string
+			}
 
 		}
 
@@ -280,30 +404,85 @@ func ExecN1QLStmt(line string, n1ql *sql.DB, w io.Writer) (int, string) {
 		if err != nil {
 			return errors.ROWS_CLOSE, err.Error()
 		}
+		timing.Done()
 
-		//Suffix to result array
-		_, werr = io.WriteString(w, "\n    ],")
-
-		//Write the status and the metrics
-		if status != "" {
-			_, werr = io.WriteString(w, "\n    \"status\": \""+status+"\"")
+		//Write the errors and warnings, the status and the metrics
+		if hasMessages(errs) || hasMessages(warnings) {
+			err_code, err_str := formatter.Messages(errs, warnings)
+			if err_code != 0 {
+				return err_code, err_str
+			}
 		}
-		if metrics != nil {
-			_, werr = io.WriteString(w, ",\n    \"metrics\": ")
-			_, werr = io.WriteString(w, string(metrics))
+		err_code, err_str := formatter.Status(status)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+		if metrics != nil && metricsMode == METRICS_FULL {
+			err_code, err_str = formatter.Metrics(metrics)
+			if err_code != 0 {
+				return err_code, err_str
+			}
 		}
 
-		_, werr = io.WriteString(w, "\n}\n")
+		err_code, err_str = formatter.End()
+		if err_code != 0 {
+			return err_code, err_str
+		}
+
+		if more {
+			if werr := writeLimitNote(note, shown); werr != nil {
+				return errors.WRITER_OUTPUT, werr.Error()
+			}
+		}
 
-		// For any captured write error
-		if werr != nil {
+		if werr := writeTimingNotes(note, timing, shown, metrics, metricsMode, timingOn); werr != nil {
 			return errors.WRITER_OUTPUT, werr.Error()
 		}
+
+		if hasMessages(errs) {
+			return command.SERVER_ERRORS, string(errs)
+		}
 	}
 
 	return 0, ""
 }
 
+/* Write the response of a statement that failed, which holds the
+   errors returned by the query service instead of results. The
+   errors are returned as the message of SERVER_ERRORS, so that
+   the exit code can be found from them.
+*/
+func writeQueryError(formatter Formatter, response *queryResponse, metricsMode string) (int, string) {
+	err_code, err_str := formatter.Header(response.RequestID, nil)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	err_code, err_str = formatter.Messages(response.Errors, response.Warnings)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	err_code, err_str = formatter.Status(response.Status)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	if response.Metrics != nil && metricsMode == METRICS_FULL {
+		err_code, err_str = formatter.Metrics(response.Metrics)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+	}
+	err_code, err_str = formatter.End()
+	if err_code != 0 {
+		return err_code, err_str
+	}
+
+	errs, err_code, err_str := compactJSON(response.Errors)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	return command.SERVER_ERRORS, string(errs)
+}
+
 /* From
 http://intogooglego.blogspot.com/2015/05/day-6-string-minifier-remove-whitespaces.html
 */
@@ -325,6 +504,24 @@ func stringMinifier(in string) (out string) {
 
 func ExecShellCmd(line string) (int, string) {
 
+	// \SET and \PUSH of the results of a statement.
+	ok, err_code, err_str := captureResults(line)
+	if ok {
+		return err_code, err_str
+	}
+
+	// \EXPORT of the results of a statement to a file.
+	ok, err_code, err_str = exportResults(line)
+	if ok {
+		return err_code, err_str
+	}
+
+	// \IMPORT of the records of a file into a keyspace.
+	ok, err_code, err_str = importRecords(line)
+	if ok {
+		return err_code, err_str
+	}
+
 	arg1 := strings.Split(line, " ")
 	arg1str := strings.ToLower(arg1[0])
 
@@ -366,7 +563,28 @@ func ExecShellCmd(line string) (int, string) {
 	if (strings.HasPrefix(line, "\\source") || strings.HasPrefix(line, "\\load")) &&
 		command.FILE_INPUT == true {
 
-		fmt.Println("ISHA DEBUG : FILENAME ", command.FILE_INPUT)
+		/* Run the statements in the file in the current session.
+		   Errors within the file are reported as they occur, along
+		   with the file name and line.
+		*/
+		path := command.FILE_NAME
+		command.FILE_INPUT = false
+		command.FILE_NAME = ""
+
+		err_code, err_str := ExecFile(path)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+	}
+
+	if command.FILE_OUTPUT != "" {
+		path := command.FILE_OUTPUT
+		command.FILE_OUTPUT = ""
+
+		err_code, err_str := RedirectOutput(path)
+		if err_code != 0 {
+			return err_code, err_str
+		}
 	}
 
 	SERVICE_URL = command.SERVICE_URL
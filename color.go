@@ -0,0 +1,232 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+	"github.com/mattn/go-runewidth"
+)
+
+/* Environment variable that turns off colours when it is set to
+   any value. See no-color.org.
+*/
+const NO_COLOR_ENV = "NO_COLOR"
+
+/* The theme that turns off the colours of the results. */
+const THEME_NONE = "none"
+
+/* A Theme gives the colours used for each kind of JSON token in
+   the results.
+*/
+type Theme struct {
+	Key    string
+	String string
+	Number string
+	Bool   string
+	Null   string
+}
+
+/* The themes that can be chosen with the theme predefined
+   session variable.
+*/
+var THEMES = map[string]*Theme{
+	"default": &Theme{
+		Key:    "\x1b[34;1m",
+		String: "\x1b[32m",
+		Number: "\x1b[36m",
+		Bool:   "\x1b[33m",
+		Null:   "\x1b[90m",
+	},
+	"dark": &Theme{
+		Key:    "\x1b[94m",
+		String: "\x1b[92m",
+		Number: "\x1b[96m",
+		Bool:   "\x1b[93m",
+		Null:   "\x1b[37m",
+	},
+	"light": &Theme{
+		Key:    "\x1b[34m",
+		String: "\x1b[32m",
+		Number: "\x1b[35m",
+		Bool:   "\x1b[31m",
+		Null:   "\x1b[90m",
+	},
+	THEME_NONE: nil,
+}
+
+/* Return true if colours should be used for the output w, which
+   is when w is a terminal and NO_COLOR is not set.
+*/
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv(NO_COLOR_ENV) != "" {
+		return false
+	}
+	if pager, ok := w.(*Pager); ok {
+		w = pager.w
+	}
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+/* Turn the colour codes used to print errors on or off. */
+func setColor(on bool) {
+	if on {
+		reset = "\x1b[0m"
+		fgRed = "\x1b[31m"
+	} else {
+		reset = ""
+		fgRed = ""
+	}
+	command.SetColor(on)
+}
+
+/* Return the theme for the results written to w, or nil if they
+   should not be coloured.
+*/
+func resultTheme(w io.Writer) *Theme {
+	if !colorEnabled(w) {
+		return nil
+	}
+	theme, _, _ := currentTheme()
+	return theme
+}
+
+/* Return the theme given by the theme predefined session
+   variable.
+*/
+func currentTheme() (*Theme, int, string) {
+	v, err_code, _ := command.PreDefSV["theme"].Top()
+	if err_code != 0 {
+		return THEMES["default"], 0, ""
+	}
+
+	name := command.ValToStr(v)
+	if v.Type() == value.STRING {
+		name = v.Actual().(string)
+	}
+
+	theme, ok := THEMES[strings.ToLower(name)]
+	if !ok {
+		return nil, command.INVALID_ARG_VALUE, "theme : " + name + ". Possible values : " + themeNames()
+	}
+	return theme, 0, ""
+}
+
+func themeNames() string {
+	names := make([]string, 0, len(THEMES))
+	for name, _ := range THEMES {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "/")
+}
+
+/* Colour the JSON tokens in the input. The input can be part of a
+   JSON document, as long as it does not split a token. A string
+   followed by a : is coloured as a key.
+*/
+func colorJSON(b []byte, theme *Theme) []byte {
+	if theme == nil {
+		return b
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(b) && b[j] != '"' {
+				if b[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(b) {
+				j++
+			}
+
+			// Look past the white space for a :
+			k := j
+			for k < len(b) && isSpace(rune(b[k])) {
+				k++
+			}
+			color := theme.String
+			if k < len(b) && b[k] == ':' {
+				color = theme.Key
+			}
+			writeColored(&buf, b[i:j], color)
+			i = j
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(b) && strings.IndexByte("0123456789+-.eE", b[j]) >= 0 {
+				j++
+			}
+			writeColored(&buf, b[i:j], theme.Number)
+			i = j
+
+		case bytes.HasPrefix(b[i:], []byte("true")):
+			writeColored(&buf, b[i:i+4], theme.Bool)
+			i += 4
+
+		case bytes.HasPrefix(b[i:], []byte("false")):
+			writeColored(&buf, b[i:i+5], theme.Bool)
+			i += 5
+
+		case bytes.HasPrefix(b[i:], []byte("null")):
+			writeColored(&buf, b[i:i+4], theme.Null)
+			i += 4
+
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeColored(buf *bytes.Buffer, token []byte, color string) {
+	buf.WriteString(color)
+	buf.Write(token)
+	buf.WriteString("\x1b[0m")
+}
+
+/* Return the display width of a line, without its escape
+   sequences.
+*/
+func coloredWidth(line string) int {
+	if strings.IndexByte(line, '\x1b') < 0 {
+		return runewidth.StringWidth(line)
+	}
+
+	width := 0
+	escape := false
+	for _, r := range line {
+		switch {
+		case escape:
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				escape = false
+			}
+		case r == '\x1b':
+			escape = true
+		default:
+			width += runewidth.RuneWidth(r)
+		}
+	}
+	return width
+}
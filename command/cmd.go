@@ -30,6 +30,9 @@ const (
 	ECHO_CMD       = "ECHO"
 	UNALIAS_CMD    = "UNALIAS"
 	SOURCE_CMD     = "SOURCE"
+	REDIRECT_CMD   = "REDIRECT"
+	EXPORT_CMD     = "EXPORT"
+	IMPORT_CMD     = "IMPORT"
 )
 
 const (
@@ -49,6 +52,10 @@ var (
 	EXIT = false
 	//Used to check for files
 	FILE_INPUT = false
+	//Used to pass the file to load to the shell
+	FILE_NAME = ""
+	//Used to redirect the output to a file
+	FILE_OUTPUT = ""
 	//Total no. of commands
 	MAX_COMMANDS = len(COMMAND_LIST)
 	//Total number of
@@ -90,6 +97,12 @@ var COMMAND_LIST = map[string]ShellCommand{
 	"\\echo":    &Echo{},
 	"\\alias":   &Alias{},
 	"\\unalias": &Unalias{},
+
+	/* Scripting */
+	"\\source":   &Source{},
+	"\\redirect": &Redirect{},
+	"\\export":   &Export{},
+	"\\import":   &Import{},
 }
 
 /*
@@ -34,6 +34,13 @@ var (
 		"histsize":   Stack_Helper(),
 		"autoconfig": Stack_Helper(),
 		"state":      Stack_Helper(),
+		"format":     Stack_Helper(),
+		"indent":     Stack_Helper(),
+		"missing":    Stack_Helper(),
+		"pager":      Stack_Helper(),
+		"theme":      Stack_Helper(),
+		"timing":     Stack_Helper(),
+		"metrics":    Stack_Helper(),
 	}
 )
 
@@ -77,6 +84,48 @@ func init() {
 		s_err := HandleError(err_code, err_str)
 		PrintError(s_err)
 	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "format", "\"json\"")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "indent", "4")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "missing", "\"\"")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "pager", "\"auto\"")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "theme", "\"default\"")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "timing", "false")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
+
+	err_code, err_str = PushValue_Helper(false, PreDefSV, "metrics", "\"full\"")
+	if err_code != 0 {
+		s_err := HandleError(err_code, err_str)
+		PrintError(s_err)
+	}
 }
 
 /* The Resolve method is used to evaluate the input parameter
@@ -216,30 +265,40 @@ func PushValue_Helper(set bool, param map[string]*Stack, vble, value string) (er
 	err_code = 0
 	err_str = ""
 
-	st_Val, ok := param[vble]
-
 	v, err_code, err_str := Resolve(value)
 	if err_code != 0 {
 		return err_code, err_str
 	} else {
-		//Stack already exists
-		if ok {
-			if set == true {
-				err_code, err_str = st_Val.SetTop(v)
-				if err_code != 0 {
-					return err_code, err_str
-				}
-			} else if set == false {
-				st_Val.Push(v)
-			}
+		err_code, err_str = PushVal_Helper(set, param, vble, v)
+	}
+	return
 
-		} else {
-			/* If the stack for the input variable is empty then
-			   push the current value onto the variable stack.
-			*/
-			param[vble] = Stack_Helper()
-			param[vble].Push(v)
+}
+
+/* Helper function to push or set a value.Value in a stack. */
+func PushVal_Helper(set bool, param map[string]*Stack, vble string, v value.Value) (err_code int, err_str string) {
+	err_code = 0
+	err_str = ""
+
+	st_Val, ok := param[vble]
+
+	//Stack already exists
+	if ok {
+		if set == true {
+			err_code, err_str = st_Val.SetTop(v)
+			if err_code != 0 {
+				return err_code, err_str
+			}
+		} else if set == false {
+			st_Val.Push(v)
 		}
+
+	} else {
+		/* If the stack for the input variable is empty then
+		   push the current value onto the variable stack.
+		*/
+		param[vble] = Stack_Helper()
+		param[vble].Push(v)
 	}
 	return
 
@@ -430,6 +489,40 @@ func PushOrSet(args []string, pushvalue bool) (int, string) {
 	return 0, ""
 }
 
+/* The PushOrSetValue method is used to push or set a value that
+   is not given as a string, such as the results of a statement.
+   Only user defined session variables and named parameters can
+   hold such values.
+*/
+func PushOrSetValue(name string, v value.Value, set bool) (int, string) {
+
+	if strings.HasPrefix(name, "-$") {
+		// For Named Parameters
+		vble := name[2:]
+
+		err_code, err_str := PushVal_Helper(set, NamedParam, vble, v)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+
+		//Pass the named parameters to the rest api using the SetQueryParams method
+		go_n1ql.SetQueryParams("$"+vble, ValToStr(v))
+
+	} else if strings.HasPrefix(name, "$") {
+		// For User defined session variables
+		vble := name[1:]
+
+		err_code, err_str := PushVal_Helper(set, UserDefSV, vble, v)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+
+	} else {
+		return errors.NO_SUCH_PARAM, " " + name + " "
+	}
+	return 0, ""
+}
+
 func printDesc(cmdname string) (int, string) {
 	var werr error
 	switch cmdname {
@@ -473,12 +566,26 @@ func printDesc(cmdname string) (int, string) {
 
 	case SET_CMD:
 		_, werr = io.WriteString(W, "Set the value of the given parameter to the input value. <parameter> = <prefix><name>\n")
-		_, werr = io.WriteString(W, "\tExample : \n\t        \\SET -$r 9.5 ;\n\t        \\SET $Val -$r ;\n")
+		_, werr = io.WriteString(W, "A user defined session variable or named parameter can be set to the results of a statement using = (<statement>). A single result is stored as it is, and several results as an array. Use = (<statement>)[<index>] for one result, or = (<statement>)[*] to always store the array. \\PUSH accepts the same form.\n")
+		_, werr = io.WriteString(W, "The predefined session variable format selects the output format for the results of statements.\n")
+		_, werr = io.WriteString(W, "\tExample : \n\t        \\SET -$r 9.5 ;\n\t        \\SET $Val -$r ;\n\t        \\SET $count = (SELECT RAW COUNT(*) FROM `beer-sample`) ;\n\t        \\SET format json ;\n")
 
 	case SOURCE_CMD:
-		_, werr = io.WriteString(W, "Load input file into shell\n")
+		_, werr = io.WriteString(W, "Load input file into shell. Relative paths in a nested \\SOURCE are resolved against the directory of the file that contains it.\n")
 		_, werr = io.WriteString(W, " For Example : \n\t \\SOURCE temp1.txt ;\n")
 
+	case REDIRECT_CMD:
+		_, werr = io.WriteString(W, "Copy the output of all the commands and their results to the input file as well as the terminal, until \\REDIRECT OFF. Output is appended to the file. Use ./off for a file named off.\n")
+		_, werr = io.WriteString(W, "\tExample : \n\t        \\REDIRECT temp1.txt ;\n\t        \\REDIRECT OFF ;\n")
+
+	case EXPORT_CMD:
+		_, werr = io.WriteString(W, "Run the statement and write its results to the input file. The whole response is read into memory before it is written. The format is json (an array of the results), ndjson, csv or tsv. If it is not given it is chosen by the extension of the file, and is json otherwise. The file is replaced if it exists.\n")
+		_, werr = io.WriteString(W, "\tExample : \n\t        \\EXPORT breweries.csv SELECT name, city FROM `beer-sample` WHERE type = 'brewery' ;\n\t        \\EXPORT beers.json ndjson SELECT * FROM `beer-sample` WHERE type = 'beer' ;\n")
+
+	case IMPORT_CMD:
+		_, werr = io.WriteString(W, "Load the records of the input file into the keyspace, using batches of UPSERT statements. The file holds json (an array of records, or records one after another), ndjson, csv or tsv, chosen by format=<format> or by the extension of the file. The key of each document is given by the N1QL expression, which refers to the fields of the record. batch=<n> gives the number of records in each statement (100 by default), and parallel=<n> the number of statements run at the same time (4 by default). The records that could not be loaded are listed at the end.\n")
+		_, werr = io.WriteString(W, "\tExample : \n\t        \\IMPORT `travel-sample` airlines.json key=type || \"_\" || TO_STRING(id) ;\n\t        \\IMPORT fixtures users.csv key=email batch=500 parallel=8 ;\n")
+
 	case UNALIAS_CMD:
 		_, werr = io.WriteString(W, "Delete the alias given by <alias name>.\n")
 		_, werr = io.WriteString(W, "\tExample : \n\t        \\UNALIAS serverversion;\n\t        \\UNALIAS subcommand1 subcommand2 serverversion;\n")
@@ -23,6 +23,17 @@ import (
 var reset = "\x1b[0m"
 var fgRed = "\x1b[31m"
 
+/* Shell errors that are not defined in the n1ql errors package.
+   They are reported as unknown errors with a message describing
+   the problem.
+*/
+const (
+	INVALID_ARG_VALUE  = 190
+	INVALID_EXPRESSION = 191
+	UNBALANCED_BLOCK   = 192
+	SERVER_ERRORS      = 193
+)
+
 /* The handleError method creates the error using the methods
    defined in the n1ql errors package. This is where all the
    shell errors are handled.
@@ -54,11 +65,11 @@ func HandleError(err int, msg string) errors.Error {
 
 	//Read/Write/Update file errors
 	case errors.READ_FILE:
-		return errors.NewShellErrorReadFile("Error during file read. ")
+		return errors.NewShellErrorReadFile("Error during file read. " + msg)
 	case errors.WRITE_FILE:
 		return errors.NewShellErrorWriteFile("Error during file write. ")
 	case errors.FILE_OPEN:
-		return errors.NewShellErrorOpenFile("Unable to open file. ")
+		return errors.NewShellErrorOpenFile("Unable to open file. " + msg)
 	case errors.FILE_CLOSE:
 		return errors.NewShellErrorCloseFile("Unable to close file. ")
 
@@ -101,6 +112,14 @@ func HandleError(err int, msg string) errors.Error {
 		return errors.NewShellErrorUnbalancedParen("Unbalanced Parenthesis in the input.")
 	case errors.ROWS_CLOSE:
 		return errors.NewShellErrorRowsClose(msg)
+	case INVALID_ARG_VALUE:
+		return errors.NewShellErrorUnkownError("Invalid value for " + msg)
+	case INVALID_EXPRESSION:
+		return errors.NewShellErrorUnkownError("Invalid expression " + msg)
+	case UNBALANCED_BLOCK:
+		return errors.NewShellErrorUnkownError("Unbalanced block in the input. " + msg)
+	case SERVER_ERRORS:
+		return errors.NewShellErrorUnkownError("The query service returned errors. " + msg)
 
 	default:
 		return errors.NewShellErrorUnkownError(msg)
@@ -108,6 +127,19 @@ func HandleError(err int, msg string) errors.Error {
 
 }
 
+/*
+	Turn the colour codes used to print errors on or off.
+*/
+func SetColor(on bool) {
+	if on {
+		reset = "\x1b[0m"
+		fgRed = "\x1b[31m"
+	} else {
+		reset = ""
+		fgRed = ""
+	}
+}
+
 /*
 	Function to print the error in Red.
 */
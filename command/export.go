@@ -0,0 +1,71 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package command
+
+import (
+	"io"
+
+	"github.com/couchbase/query/errors"
+)
+
+/* Export Command */
+type Export struct {
+	ShellCommand
+}
+
+func (this *Export) Name() string {
+	return "EXPORT"
+}
+
+func (this *Export) CommandCompletion() bool {
+	return false
+}
+
+func (this *Export) MinArgs() int {
+	return 2
+}
+
+func (this *Export) MaxArgs() int {
+	return MAX_ARGS
+}
+
+func (this *Export) ExecCommand(args []string) (int, string) {
+	/* Command to write the results of a statement to a file.
+	   The input arguments are the file name, an optional format
+	   and the statement.
+	*/
+	if len(args) > this.MaxArgs() {
+		return errors.TOO_MANY_ARGS, ""
+
+	} else if len(args) < this.MinArgs() {
+		return errors.TOO_FEW_ARGS, ""
+	}
+
+	/* The statement is run by the main package before the input
+	   is split into arguments, so that the white space in its
+	   strings is kept. See exportResults.
+	*/
+	return 0, ""
+}
+
+func (this *Export) PrintHelp(desc bool) (int, string) {
+	_, werr := io.WriteString(W, "\\EXPORT <filename> [<format>] <statement>\n")
+	if desc {
+		err_code, err_str := printDesc(this.Name())
+		if err_code != 0 {
+			return err_code, err_str
+		}
+	}
+	_, werr = io.WriteString(W, "\n")
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
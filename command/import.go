@@ -0,0 +1,72 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package command
+
+import (
+	"io"
+
+	"github.com/couchbase/query/errors"
+)
+
+/* Import Command */
+type Import struct {
+	ShellCommand
+}
+
+func (this *Import) Name() string {
+	return "IMPORT"
+}
+
+func (this *Import) CommandCompletion() bool {
+	return false
+}
+
+func (this *Import) MinArgs() int {
+	return 3
+}
+
+func (this *Import) MaxArgs() int {
+	return MAX_ARGS
+}
+
+func (this *Import) ExecCommand(args []string) (int, string) {
+	/* Command to load the records of a file into a keyspace.
+	   The input arguments are the keyspace, the file name, the
+	   expression for the document keys and the options.
+	*/
+	if len(args) > this.MaxArgs() {
+		return errors.TOO_MANY_ARGS, ""
+
+	} else if len(args) < this.MinArgs() {
+		return errors.TOO_FEW_ARGS, ""
+	}
+
+	/* The file is loaded by the main package before the input
+	   is split into arguments, so that the white space in the
+	   key expression is kept. See importRecords. The input only
+	   gets here if the key expression is missing.
+	*/
+	return INVALID_ARG_VALUE, "key. The document keys must be given by key=<expression>."
+}
+
+func (this *Import) PrintHelp(desc bool) (int, string) {
+	_, werr := io.WriteString(W, "\\IMPORT <keyspace> <filename> key=<expression> [batch=<n>] [parallel=<n>] [format=<format>]\n")
+	if desc {
+		err_code, err_str := printDesc(this.Name())
+		if err_code != 0 {
+			return err_code, err_str
+		}
+	}
+	_, werr = io.WriteString(W, "\n")
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
@@ -53,6 +53,7 @@ func (this *Source) ExecCommand(args []string) (int, string) {
 		   can be loaded from the file.
 		*/
 		FILE_INPUT = true
+		FILE_NAME = args[0]
 	}
 	return 0, ""
 }
@@ -0,0 +1,245 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+)
+
+/* The CSV formatter writes a header line followed by a line for
+   each result, quoted as described in RFC 4180. Nested objects
+   are flattened into columns with dotted names such as geo.lat,
+   and arrays are written as JSON. The columns are those of the
+   signature, and the fields of the nested objects are taken from
+   the first result, so that the results can be written as they
+   are read. If the signature has a * then all the columns come
+   from the first result, and fields of later results that are
+   not in the first are not written; they are named in a warning
+   on os.Stderr once the results end. A later result that has an
+   object where the first had a single column is written as JSON
+   in that column. Fields that are MISSING are written as the
+   marker given by the missing predefined session variable, and
+   NULL values as null. The status and metrics are not written,
+   and the errors and warnings are listed on os.Stderr. Lines end
+   with CRLF, as RFC 4180 requires.
+*/
+type CSVFormatter struct {
+	w         *csv.Writer
+	signature []string
+	columns   []string
+	missing   string
+	dropped   []string
+}
+
+func NewCSVFormatter(w io.Writer) Formatter {
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	return &CSVFormatter{w: writer, missing: currentMissing()}
+}
+
+/* The TSV formatter is the CSV formatter with tabs between the
+   fields. Its lines end with LF, as tab separated files have no
+   standard that asks for CRLF and are mostly read by line based
+   tools.
+*/
+func NewTSVFormatter(w io.Writer) Formatter {
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+	return &CSVFormatter{w: writer, missing: currentMissing()}
+}
+
+func (this *CSVFormatter) Header(requestID string, signature json.RawMessage) (int, string) {
+	this.signature = signatureColumns(signature)
+	return 0, ""
+}
+
+func (this *CSVFormatter) Row(row []byte) (int, string) {
+	fields, names, leaves, err_code, err_str := flatRow(row)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+
+	if this.columns == nil {
+		this.columns = flatColumns(this.signature, names, leaves)
+		if err_code, err_str := this.write(this.columns); err_code != 0 {
+			return err_code, err_str
+		}
+	} else {
+		this.dropped = droppedFields(this.dropped, this.columns, names, leaves)
+	}
+
+	record := make([]string, len(this.columns))
+	for i, name := range this.columns {
+		if val, ok := fields[name]; ok {
+			record[i] = valueText(val)
+		} else {
+			record[i] = this.missing
+		}
+	}
+	return this.write(record)
+}
+
+func (this *CSVFormatter) Messages(errs, warnings json.RawMessage) (int, string) {
+	for _, line := range messageLines(errs, warnings) {
+		if _, werr := io.WriteString(os.Stderr, line+"\n"); werr != nil {
+			return errors.WRITER_OUTPUT, werr.Error()
+		}
+	}
+	return 0, ""
+}
+
+func (this *CSVFormatter) Status(status string) (int, string) {
+	return 0, ""
+}
+
+func (this *CSVFormatter) Metrics(metrics []byte) (int, string) {
+	return 0, ""
+}
+
+/* If there were no results then only the header is written. The
+   fields that were left out of later results are listed on
+   os.Stderr.
+*/
+func (this *CSVFormatter) End() (int, string) {
+	if len(this.dropped) > 0 {
+		warning := "warning : fields not in the first result were not written : " +
+			strings.Join(this.dropped, ", ") + "\n"
+		if _, werr := io.WriteString(os.Stderr, warning); werr != nil {
+			return errors.WRITER_OUTPUT, werr.Error()
+		}
+	}
+
+	if this.columns == nil && this.signature != nil {
+		this.columns = this.signature
+		return this.write(this.columns)
+	}
+	return 0, ""
+}
+
+func (this *CSVFormatter) write(record []string) (int, string) {
+	this.w.Write(record)
+	this.w.Flush()
+	if err := this.w.Error(); err != nil {
+		return errors.WRITER_OUTPUT, err.Error()
+	}
+	return 0, ""
+}
+
+/* Return the fields of a result by their dotted names. Every
+   nested object is returned both as a whole, under its own name,
+   and as its fields. The names of the top level fields are
+   returned as well, in order, along with the names of the leaf
+   fields under each of them. A result that is not an object is
+   returned as the single field VALUE_COLUMN.
+*/
+func flatRow(row []byte) (map[string]json.RawMessage, []string, map[string][]string, int, string) {
+	names, fields, err_code, err_str := rowFields(row)
+	if err_code != 0 {
+		return nil, nil, nil, err_code, err_str
+	}
+
+	flat := make(map[string]json.RawMessage, len(fields))
+	leaves := make(map[string][]string, len(fields))
+	for _, name := range names {
+		leaves[name] = flattenValue(flat, name, fields[name])
+	}
+	return flat, names, leaves, 0, ""
+}
+
+func flattenValue(flat map[string]json.RawMessage, name string, val json.RawMessage) []string {
+	flat[name] = val
+
+	trimmed := bytes.TrimSpace(val)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return []string{name}
+	}
+
+	keys, fields, ok := decodeObject(trimmed)
+	if !ok || len(keys) == 0 {
+		// Empty objects are kept as one column.
+		return []string{name}
+	}
+
+	var names []string
+	for _, key := range keys {
+		names = append(names, flattenValue(flat, name+"."+key, fields[key])...)
+	}
+	return names
+}
+
+/* Return the columns for the given signature and the leaf fields
+   of the first result. Each column of the signature is replaced
+   by the leaf fields under it. Fields of the result that are not
+   in the signature follow those that are, in their own order.
+*/
+func flatColumns(signature, names []string, leaves map[string][]string) []string {
+	all := make([]string, 0, len(signature)+len(names))
+	all = append(all, signature...)
+	for _, name := range names {
+		if !contains(signature, name) {
+			all = append(all, name)
+		}
+	}
+
+	columns := make([]string, 0, len(all))
+	for _, name := range all {
+		if names, ok := leaves[name]; ok {
+			columns = append(columns, names...)
+		} else {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+/* Add to dropped the leaf fields of a result that have no
+   column. A field is written when it, or an object that holds
+   it, has a column.
+*/
+func droppedFields(dropped, columns, names []string, leaves map[string][]string) []string {
+	for _, name := range names {
+		for _, leaf := range leaves[name] {
+			if hasColumn(columns, leaf) || contains(dropped, leaf) {
+				continue
+			}
+			dropped = append(dropped, leaf)
+		}
+	}
+	return dropped
+}
+
+func hasColumn(columns []string, name string) bool {
+	for {
+		if contains(columns, name) {
+			return true
+		}
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 {
+			return false
+		}
+		name = name[:dot]
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDroppedFields(t *testing.T) {
+	tests := []struct {
+		first    string
+		rows     []string
+		expected []string
+	}{
+		{`{"a":1,"b":2}`, []string{`{"a":3}`, `{"b":4,"a":5}`}, nil},
+		{`{"a":1}`, []string{`{"a":2,"b":3}`, `{"c":4,"b":5}`}, []string{"b", "c"}},
+		{`{"geo":{"lat":1}}`, []string{`{"geo":{"lat":2,"lon":3}}`}, []string{"geo.lon"}},
+		{`{"geo":null}`, []string{`{"geo":{"lat":2,"lon":3}}`}, nil},
+		{`1`, []string{`{"a":1}`}, []string{"a"}},
+	}
+
+	for _, test := range tests {
+		_, names, leaves, err_code, _ := flatRow([]byte(test.first))
+		if err_code != 0 {
+			t.Fatalf("flatRow(%s) failed", test.first)
+		}
+		columns := flatColumns(nil, names, leaves)
+
+		var dropped []string
+		for _, row := range test.rows {
+			_, names, leaves, _, _ := flatRow([]byte(row))
+			dropped = droppedFields(dropped, columns, names, leaves)
+		}
+		if !reflect.DeepEqual(dropped, test.expected) {
+			t.Errorf("%s %v : dropped %q, expected %q", test.first, test.rows, dropped, test.expected)
+		}
+	}
+}
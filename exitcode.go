@@ -0,0 +1,109 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* Exit codes of the shell. Each category of error has its own
+   code so that scripts can tell what went wrong. Exit code 2 is
+   also used by the flag package for invalid options.
+*/
+const (
+	EXIT_SUCCESS    = 0
+	EXIT_GENERAL    = 1
+	EXIT_USAGE      = 2
+	EXIT_CONNECTION = 3
+	EXIT_AUTH       = 4
+	EXIT_QUERY      = 5
+	EXIT_COMMAND    = 6
+	EXIT_FILE       = 7
+)
+
+/* The exit code of the first error in the input, used when the
+   shell is run with -file or reads from a pipe.
+*/
+var exitStatus = EXIT_SUCCESS
+
+/* Errors returned by go_n1ql when the query service cant be
+   reached. They are reported as query errors, but the shell
+   exits with EXIT_CONNECTION for them.
+*/
+var connectionErrors = []string{
+	"connection refused",
+	"no such host",
+	"no route to host",
+	"network is unreachable",
+	"unsupported protocol scheme",
+	"no host in request url",
+	"unknown port",
+	"i/o timeout",
+}
+
+/* Errors returned by the query service when the credentials are
+   missing or invalid.
+*/
+var authErrors = []string{
+	"\"code\":10000",
+	"\"code\":13014",
+	"error 10000 :",
+	"error 13014 :",
+	"authentication failed",
+	"401 unauthorized",
+}
+
+/* Return the exit code for an error code returned by
+   execute_input, along with its message.
+*/
+func exitCode(err_code int, err_str string) int {
+	switch err_code {
+	case 0:
+		return EXIT_SUCCESS
+
+	case errors.CONNECTION_REFUSED, errors.UNSUPPORTED_PROTOCOL, errors.NO_SUCH_HOST,
+		errors.NO_HOST_IN_URL, errors.UNKNOWN_PORT_TCP, errors.NO_ROUTE_TO_HOST,
+		errors.UNREACHABLE_NETWORK, errors.NO_CONNECTION, errors.GO_N1QL_OPEN,
+		errors.OPERATION_TIMEOUT:
+		return EXIT_CONNECTION
+
+	case errors.INVALID_PASSWORD, errors.INVALID_USERNAME, errors.MISSING_CREDENTIAL:
+		return EXIT_AUTH
+
+	case errors.GON1QL_QUERY, command.SERVER_ERRORS:
+		msg := strings.ToLower(strings.Replace(err_str, " ", "", -1))
+		for _, e := range connectionErrors {
+			if strings.Contains(msg, strings.Replace(e, " ", "", -1)) {
+				return EXIT_CONNECTION
+			}
+		}
+		for _, e := range authErrors {
+			if strings.Contains(msg, strings.Replace(e, " ", "", -1)) {
+				return EXIT_AUTH
+			}
+		}
+		return EXIT_QUERY
+
+	case errors.NO_SUCH_COMMAND, errors.NO_SUCH_PARAM, errors.TOO_MANY_ARGS,
+		errors.TOO_FEW_ARGS, errors.STACK_EMPTY, errors.NO_SUCH_ALIAS,
+		errors.UNBALANCED_PAREN, command.INVALID_ARG_VALUE,
+		command.INVALID_EXPRESSION, command.UNBALANCED_BLOCK:
+		return EXIT_COMMAND
+
+	case errors.READ_FILE, errors.WRITE_FILE, errors.FILE_OPEN, errors.FILE_CLOSE:
+		return EXIT_FILE
+
+	default:
+		return EXIT_GENERAL
+	}
+}
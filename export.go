@@ -0,0 +1,223 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* \EXPORT writes the results of a statement to a file :
+       \EXPORT <file> [<format>] <statement>
+   The file name can be quoted if it contains spaces.
+*/
+var exportCmd = regexp.MustCompile(`(?is)^\\export\s+("[^"]*"|\S+)\s+(\S.*)$`)
+
+/* Formats that results can be exported in. json is an array of
+   the results, instead of the response written by the json output
+   format.
+*/
+var EXPORT_FORMATTERS = map[string]func(w io.Writer) Formatter{
+	FORMAT_JSON:   NewArrayFormatter,
+	FORMAT_NDJSON: newExportNDJSONFormatter,
+	FORMAT_CSV:    NewCSVFormatter,
+	FORMAT_TSV:    NewTSVFormatter,
+}
+
+/* The format used for each file extension, when the format is not
+   given.
+*/
+var EXPORT_EXTENSIONS = map[string]string{
+	".json":   FORMAT_JSON,
+	".ndjson": FORMAT_NDJSON,
+	".jsonl":  FORMAT_NDJSON,
+	".csv":    FORMAT_CSV,
+	".tsv":    FORMAT_TSV,
+}
+
+/* How often the number of exported results is updated. */
+const PROGRESS_INTERVAL = 250 * time.Millisecond
+
+/* The NDJSON formatter without the object holding the status and
+   metrics, so that only the results are exported.
+*/
+func newExportNDJSONFormatter(w io.Writer) Formatter {
+	formatter := NewNDJSONFormatter(w).(*NDJSONFormatter)
+	formatter.meta = ioutil.Discard
+	return formatter
+}
+
+/* If the input is an \EXPORT command, run the statement and write
+   its results to the file. The first return value is false if the
+   input is not of this form.
+*/
+func exportResults(line string) (bool, int, string) {
+	m := exportCmd.FindStringSubmatch(line)
+	if m == nil {
+		return false, 0, ""
+	}
+
+	path := strings.Trim(m[1], "\"")
+	stmt := m[2]
+
+	// The format is optional, since no statement starts with one.
+	format := EXPORT_EXTENSIONS[strings.ToLower(filepath.Ext(path))]
+	if format == "" {
+		format = FORMAT_JSON
+	}
+	fields := strings.Fields(stmt)
+	if _, ok := EXPORT_FORMATTERS[strings.ToLower(fields[0])]; ok {
+		if len(fields) == 1 {
+			return true, errors.TOO_FEW_ARGS, ""
+		}
+		format = strings.ToLower(fields[0])
+		stmt = strings.TrimSpace(stmt[len(fields[0]):])
+	}
+
+	err_code, err_str := ExportStmt(path, format, stmt)
+	return true, err_code, err_str
+}
+
+/* Run the statement and write its results to the file in the
+   given format. go_n1ql reads the whole response before it
+   returns the first result, so the results are held in memory
+   while they are written; the export is not streamed. The number
+   written so far is shown on os.Stderr if it is a terminal. They are written to a temporary file in the same
+   directory, which only replaces the file once the statement has
+   succeeded, so that a failed statement leaves the file as it
+   was.
+*/
+func ExportStmt(path, format, line string) (int, string) {
+	if NoQueryService == true {
+		//Not connected to a query service
+		return errors.NO_CONNECTION, ""
+	}
+
+	//Substitute the values of the session variables in the statement.
+	stmt, err_code, err_str := Interpolate(line)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+
+	n1ql, err := sql.Open("n1ql", ServerFlag)
+	if err != nil {
+		return errors.GO_N1QL_OPEN, ""
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+	w := bufio.NewWriter(f)
+
+	progress := NewProgress()
+	formatter := &progressFormatter{Formatter: EXPORT_FORMATTERS[format](w), progress: progress}
+
+	// The limit predefined session variable is not used, so that
+	// all the results are exported.
+	err_code, err_str = execFormatted(stmt, n1ql, formatter, os.Stderr, 0)
+	progress.Clear()
+
+	if err := w.Flush(); err != nil && err_code == 0 {
+		err_code, err_str = errors.WRITE_FILE, err.Error()
+	}
+	if err := f.Close(); err != nil && err_code == 0 {
+		err_code, err_str = errors.FILE_CLOSE, err.Error()
+	}
+	if err_code == 0 {
+		err_code, err_str = replaceFile(f.Name(), path)
+	}
+	if err_code != 0 {
+		os.Remove(f.Name())
+		return err_code, err_str
+	}
+
+	summary := fmt.Sprintf("Exported %s to %s in %s\n", rowCount(progress.count), path, formatDuration(time.Since(progress.start)))
+	_, werr := io.WriteString(noteWriter(command.W), summary)
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
+
+/* Move the temporary file to path. It keeps the permissions of
+   the file it replaces, or is given 0644 if there is none.
+*/
+func replaceFile(tmp, path string) (int, string) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return errors.WRITE_FILE, err.Error()
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.WRITE_FILE, err.Error()
+	}
+	return 0, ""
+}
+
+/* A Progress shows the number of results handled so far on
+   os.Stderr, if it is a terminal, updated every PROGRESS_INTERVAL.
+*/
+type Progress struct {
+	w     io.Writer
+	count int
+	start time.Time
+	last  time.Time
+	shown bool
+}
+
+func NewProgress() *Progress {
+	start := time.Now()
+	this := &Progress{start: start, last: start}
+	if isTerminal(os.Stderr) {
+		this.w = os.Stderr
+	}
+	return this
+}
+
+func (this *Progress) Add(n int) {
+	this.count += n
+	if this.w != nil && time.Since(this.last) >= PROGRESS_INTERVAL {
+		this.last = time.Now()
+		this.shown = true
+		io.WriteString(this.w, fmt.Sprintf("\r%s ...", rowCount(this.count)))
+	}
+}
+
+/* Clear the count once done. */
+func (this *Progress) Clear() {
+	if this.shown {
+		io.WriteString(this.w, "\r\x1b[K")
+	}
+}
+
+/* A progressFormatter counts the results passed to a Formatter. */
+type progressFormatter struct {
+	Formatter
+	progress *Progress
+}
+
+func (this *progressFormatter) Row(row []byte) (int, string) {
+	this.progress.Add(1)
+	return this.Formatter.Row(row)
+}
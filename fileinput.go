@@ -0,0 +1,156 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* Maximum number of files that can be nested using \SOURCE.
+   This stops a file that includes itself, directly or through
+   another file, from recursing forever.
+*/
+const MAX_SOURCE_DEPTH = 16
+
+/* Files currently being executed, innermost last. */
+var sourceFiles []string
+
+/* This method opens the input file and executes the statements
+   in it one at a time. It is used by the -file option and the
+   \SOURCE command. A relative path given to a nested \SOURCE is
+   resolved against the directory of the file that contains it.
+*/
+func ExecFile(path string) (int, string) {
+	if len(sourceFiles) > 0 && !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(sourceFiles[len(sourceFiles)-1]), path)
+	}
+
+	if len(sourceFiles) >= MAX_SOURCE_DEPTH {
+		return errors.FILE_OPEN, path + " : Exceeded maximum \\SOURCE depth of " +
+			strconv.Itoa(MAX_SOURCE_DEPTH) + ". Check for files that include each other."
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+	defer f.Close()
+
+	sourceFiles = append(sourceFiles, path)
+	defer func() {
+		sourceFiles = sourceFiles[:len(sourceFiles)-1]
+	}()
+
+	return ExecReader(f, path, true)
+}
+
+/* This method reads statements from the input reader and sends
+   them to execute_input as soon as each one is complete, so that
+   the whole file never needs to be held in memory. Statements are
+   split the same way as in HandleInteractiveMode, using the
+   Splitter. A statement left unterminated at the end of the input
+   is executed as well.
+
+   The statements are run by a Script, which also handles the
+   \IF and \FOREACH blocks. If echo is true then each statement is
+   echoed along with the line it starts on before its results.
+   Errors are always reported with the line number.
+   If -exit-on-error is set then the shell exits on the first error.
+*/
+func ExecReader(r io.Reader, name string, echo bool) (int, string) {
+	reader := bufio.NewReader(r)
+	splitter := NewSplitter()
+	script := NewScript(name, echo)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.READ_FILE, name + " : " + err.Error()
+		}
+
+		if line != "" {
+			for _, stmt := range splitter.Feed(line) {
+				script.Exec(stmt)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if stmt, ok := splitter.Flush(); ok {
+		script.Exec(stmt)
+	}
+	script.End()
+	return 0, ""
+}
+
+/* Execute a single statement read from the input file, and handle
+   any errors it returns.
+*/
+func execFileStmt(stmt, name string, lineNum int, echo bool) {
+	echoFileStmt(stmt, name, lineNum, echo)
+
+	err_code, err_string := execute_logged(stmt, OUTPUT)
+	if err_code != 0 {
+		fileError(name, lineNum, err_code, err_string)
+	}
+
+	// \EXIT and \QUIT stop reading the rest of the input.
+	if EXIT == true {
+		command.EXIT = false
+		exitShell(0)
+	}
+}
+
+/* Echo a statement read from the input file before its results. */
+func echoFileStmt(stmt, name string, lineNum int, echo bool) {
+	if echo && !isDataFormat(currentFormat()) {
+		location := fmt.Sprintf("%s:%d", name, lineNum)
+		_, werr := io.WriteString(OUTPUT, "\n"+location+" > "+stmt+QRY_EOL+"\n")
+		if werr != nil {
+			s_err := command.HandleError(errors.WRITER_OUTPUT, werr.Error())
+			command.PrintError(s_err)
+		}
+	} else {
+		echoStmt(stmt)
+	}
+}
+
+/* Print an error for the given line of the input file. If
+   -exit-on-error is set then exit the shell, otherwise the
+   exit code of the first error is kept for the end of the input.
+*/
+func fileError(name string, lineNum int, err_code int, err_string string) {
+	if exitStatus == EXIT_SUCCESS {
+		exitStatus = exitCode(err_code, err_string)
+	}
+
+	io.WriteString(command.W, fmt.Sprintf("Error at %s:%d\n", name, lineNum))
+	printExecError(err_code, err_string)
+
+	if *errorExitFlag == true {
+		_, werr := io.WriteString(command.W, "Exiting on first error encountered\n")
+		if werr != nil {
+			s_err := command.HandleError(errors.WRITER_OUTPUT, werr.Error())
+			command.PrintError(s_err)
+		}
+		exitShell(exitCode(err_code, err_string))
+	}
+}
@@ -0,0 +1,358 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* Output formats for the results of N1QL statements. */
+const (
+	FORMAT_JSON   = "json"
+	FORMAT_TABLE  = "table"
+	FORMAT_ASCII  = "ascii"
+	FORMAT_CSV    = "csv"
+	FORMAT_TSV    = "tsv"
+	FORMAT_NDJSON = "ndjson"
+)
+
+/* The default number of spaces that JSON is indented by. */
+const DEFAULT_INDENT = 4
+
+/* A Formatter writes the results of a statement to the output.
+   ExecN1QLStmt calls Header once with the request id and the
+   signature, Row for each result, and then Messages, Status,
+   Metrics and End. Every result is a single JSON value, and the
+   signature, errors, warnings and metrics are passed as JSON as
+   well. Messages is only called if the server returned errors or
+   warnings, and Metrics if it returned metrics. If the statement
+   failed then the signature is nil and Row is not called.
+*/
+type Formatter interface {
+	Header(requestID string, signature json.RawMessage) (int, string)
+	Row(row []byte) (int, string)
+	Messages(errs, warnings json.RawMessage) (int, string)
+	Status(status string) (int, string)
+	Metrics(metrics []byte) (int, string)
+	End() (int, string)
+}
+
+/* Registry of the available output formats. */
+var FORMATTERS = map[string]func(w io.Writer) Formatter{
+	FORMAT_JSON:   NewJSONFormatter,
+	FORMAT_TABLE:  NewTableFormatter,
+	FORMAT_ASCII:  NewASCIIFormatter,
+	FORMAT_CSV:    NewCSVFormatter,
+	FORMAT_TSV:    NewTSVFormatter,
+	FORMAT_NDJSON: NewNDJSONFormatter,
+}
+
+/* Formats that only contain the results, so that they can be
+   read by other programs. The statements are not echoed to the
+   output in these formats.
+*/
+var DATA_FORMATS = map[string]bool{
+	FORMAT_CSV:    true,
+	FORMAT_TSV:    true,
+	FORMAT_NDJSON: true,
+}
+
+func isDataFormat(format string) bool {
+	return DATA_FORMATS[strings.ToLower(format)]
+}
+
+/* Return a Formatter for the given format that writes to w. */
+func GetFormatter(format string, w io.Writer) (Formatter, int, string) {
+	newFormatter, ok := FORMATTERS[strings.ToLower(format)]
+	if !ok {
+		return nil, command.INVALID_ARG_VALUE, "format : " + format + ". Possible values : " + formatNames()
+	}
+	if _, err_code, err_str := currentIndent(); err_code != 0 {
+		return nil, err_code, err_str
+	}
+	if _, err_code, err_str := currentTheme(); err_code != 0 {
+		return nil, err_code, err_str
+	}
+	return newFormatter(w), 0, ""
+}
+
+/* Return the current output format, given by the format
+   predefined session variable.
+*/
+func currentFormat() string {
+	v, err_code, _ := command.PreDefSV["format"].Top()
+	if err_code != 0 {
+		return FORMAT_JSON
+	}
+	if v.Type() == value.STRING {
+		return v.Actual().(string)
+	}
+	return command.ValToStr(v)
+}
+
+/* Return the marker for MISSING fields in the table and csv
+   formats, given by the missing predefined session variable.
+*/
+func currentMissing() string {
+	v, err_code, _ := command.PreDefSV["missing"].Top()
+	if err_code != 0 {
+		return ""
+	}
+	if v.Type() == value.STRING {
+		return v.Actual().(string)
+	}
+	return command.ValToStr(v)
+}
+
+/* Return the number of spaces to indent JSON by, given by the
+   indent predefined session variable.
+*/
+func currentIndent() (int, int, string) {
+	v, err_code, _ := command.PreDefSV["indent"].Top()
+	if err_code != 0 {
+		return DEFAULT_INDENT, 0, ""
+	}
+	switch width := v.Actual().(type) {
+	case int64:
+		if width >= 0 {
+			return int(width), 0, ""
+		}
+	case float64:
+		if width >= 0 && width == float64(int(width)) {
+			return int(width), 0, ""
+		}
+	}
+	return DEFAULT_INDENT, command.INVALID_ARG_VALUE, "indent : " + command.ValToStr(v) + ". It must be a number of spaces."
+}
+
+func formatNames() string {
+	names := make([]string, 0, len(FORMATTERS))
+	for name, _ := range FORMATTERS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "/")
+}
+
+/* The JSON formatter writes the results in the same envelope
+   as the response from the query service. If -pretty is set
+   then the signature, results and metrics are indented by the
+   number of spaces given by the indent predefined session
+   variable, otherwise each of them is written on one line. On a
+   terminal the output is coloured by the current theme. The
+   errors and warnings are written after the results, as they
+   are in the response.
+*/
+type JSONFormatter struct {
+	w        io.Writer
+	started  bool
+	rows     int
+	werr     error
+	indent   string
+	theme    *Theme
+	errors   json.RawMessage
+	warnings json.RawMessage
+}
+
+func NewJSONFormatter(w io.Writer) Formatter {
+	width, _, _ := currentIndent()
+	return &JSONFormatter{w: w, indent: strings.Repeat(" ", width), theme: resultTheme(w)}
+}
+
+func (this *JSONFormatter) Header(requestID string, signature json.RawMessage) (int, string) {
+	this.start()
+	this.write(this.indent + "\"requestID\": \"" + requestID + "\",\n")
+
+	// There is no signature if the statement failed.
+	if signature != nil {
+		sig, err_code, err_str := this.format(signature, 1)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+		this.write(this.indent + "\"signature\": " + string(sig) + ",\n")
+	}
+	this.write(this.indent + "\"results\" : [\n" + this.level(2))
+	return this.result()
+}
+
+func (this *JSONFormatter) Row(row []byte) (int, string) {
+	this.start()
+	if this.rows > 0 {
+		this.write(", \n" + this.level(2))
+	}
+	this.rows++
+
+	row, err_code, err_str := this.format(row, 2)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	this.write(string(row))
+	return this.result()
+}
+
+/* Keep the errors and warnings until the results are done. */
+func (this *JSONFormatter) Messages(errs, warnings json.RawMessage) (int, string) {
+	this.errors = errs
+	this.warnings = warnings
+	return 0, ""
+}
+
+func (this *JSONFormatter) Status(status string) (int, string) {
+	this.start()
+
+	//Suffix to result array
+	this.write("\n" + this.indent + "],")
+	for _, field := range []struct {
+		name     string
+		messages json.RawMessage
+	}{{"errors", this.errors}, {"warnings", this.warnings}} {
+		if !hasMessages(field.messages) {
+			continue
+		}
+		messages, err_code, err_str := this.format(field.messages, 1)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+		this.write("\n" + this.indent + "\"" + field.name + "\": " + string(messages) + ",")
+	}
+	if status != "" {
+		this.write("\n" + this.indent + "\"status\": \"" + status + "\"")
+	}
+	return this.result()
+}
+
+func (this *JSONFormatter) Metrics(metrics []byte) (int, string) {
+	metrics, err_code, err_str := this.format(metrics, 1)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	this.write(",\n" + this.indent + "\"metrics\": ")
+	this.write(string(metrics))
+	return this.result()
+}
+
+func (this *JSONFormatter) End() (int, string) {
+	this.write("\n}\n")
+	return this.result()
+}
+
+func (this *JSONFormatter) start() {
+	if !this.started {
+		this.started = true
+		this.write("\n{\n")
+	}
+}
+
+func (this *JSONFormatter) level(depth int) string {
+	return strings.Repeat(this.indent, depth)
+}
+
+/* Format a value that starts at the given depth in the envelope.
+   The value is indented when -pretty is set and the indent is
+   not 0, and compacted otherwise.
+*/
+func (this *JSONFormatter) format(b []byte, depth int) ([]byte, int, string) {
+	if *prettyFlag == false || this.indent == "" {
+		return compactJSON(b)
+	}
+	return indentJSON(b, this.level(depth), this.indent)
+}
+
+/* Keep the first write error, and report it once done. */
+func (this *JSONFormatter) write(s string) {
+	if this.werr == nil {
+		if this.theme != nil {
+			s = string(colorJSON([]byte(s), this.theme))
+		}
+		_, this.werr = io.WriteString(this.w, s)
+	}
+}
+
+func (this *JSONFormatter) result() (int, string) {
+	if this.werr != nil {
+		return errors.WRITER_OUTPUT, this.werr.Error()
+	}
+	return 0, ""
+}
+
+/* Indent a JSON value. The value is re-indented token by token,
+   so that the order of the fields and the text of numbers are
+   kept as they were sent by the server.
+*/
+func indentJSON(b []byte, prefix, indent string) ([]byte, int, string) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(b), prefix, indent); err != nil {
+		return nil, errors.JSON_UNMARSHAL, err.Error()
+	}
+	return buf.Bytes(), 0, ""
+}
+
+/* Remove the insignificant white space from a JSON value. */
+func compactJSON(b []byte) ([]byte, int, string) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil, errors.JSON_UNMARSHAL, err.Error()
+	}
+	return buf.Bytes(), 0, ""
+}
+
+/* Decode a JSON object, and return its field names in the order
+   they appear in it, along with their values. ok is false if the
+   input is not an object.
+*/
+func decodeObject(b []byte) (names []string, fields map[string]json.RawMessage, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, false
+	}
+
+	fields = map[string]json.RawMessage{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		name, _ := tok.(string)
+
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, nil, false
+		}
+		if _, dup := fields[name]; !dup {
+			names = append(names, name)
+		}
+		fields[name] = val
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, false
+	}
+	return names, fields, true
+}
+
+/* Return the columns of the signature in the order they were
+   projected. nil is returned if the signature is not an object
+   or has a *, since the columns are then only known from the
+   results.
+*/
+func signatureColumns(signature json.RawMessage) []string {
+	names, _, ok := decodeObject(signature)
+	if !ok || contains(names, "*") {
+		return nil
+	}
+	return names
+}
@@ -0,0 +1,690 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/parser/n1ql"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+	"github.com/mattn/go-runewidth"
+)
+
+/* \IMPORT loads the records of a file into a keyspace :
+       \IMPORT <keyspace> <file> key=<expression> [batch=<n>] [parallel=<n>] [format=<format>]
+   The options follow the key expression, which can contain
+   spaces. The file name can be quoted if it contains spaces.
+*/
+var importCmd = regexp.MustCompile(`(?is)^\\import\s+(\S+)\s+("[^"]*"|\S+)\s+key\s*=\s*(\S.*)$`)
+var importOption = regexp.MustCompile(`(?is)\s+(batch|parallel|format)\s*=\s*(\S+)\s*$`)
+
+/* Defaults for the batch and parallel options. */
+const (
+	IMPORT_BATCH    = 100
+	IMPORT_PARALLEL = 4
+)
+
+/* Rejected records longer than this are cut off when listed. */
+const MAX_REJECT_WIDTH = 200
+
+/* The most rejected records that are listed. Only the first ones
+   in the file are kept, so that a file that is mostly rejected is
+   not held in memory.
+*/
+const MAX_REJECTS = 100
+
+/* A record read from the file. The location is where it was
+   found, such as line 12, and seq its position in the file. If
+   the record cant be loaded then err says why.
+*/
+type importRecord struct {
+	seq      int
+	location string
+	doc      []byte
+	key      string
+	err      string
+}
+
+type importOptions struct {
+	keyspace string
+	path     string
+	format   string
+	key      expression.Expression
+	batch    int
+	parallel int
+}
+
+/* If the input is an \IMPORT command, load the records of the
+   file. The first return value is false if the input is not of
+   this form.
+*/
+func importRecords(line string) (bool, int, string) {
+	m := importCmd.FindStringSubmatch(line)
+	if m == nil {
+		return false, 0, ""
+	}
+
+	opts := &importOptions{
+		keyspace: m[1],
+		path:     strings.Trim(m[2], "\""),
+		batch:    IMPORT_BATCH,
+		parallel: IMPORT_PARALLEL,
+	}
+	opts.format = EXPORT_EXTENSIONS[strings.ToLower(filepath.Ext(opts.path))]
+	if opts.format == "" {
+		opts.format = FORMAT_JSON
+	}
+
+	// Take the options off the end of the key expression.
+	input := m[3]
+	for {
+		o := importOption.FindStringSubmatchIndex(input)
+		if o == nil {
+			break
+		}
+		name := strings.ToLower(input[o[2]:o[3]])
+		val := input[o[4]:o[5]]
+		input = input[:o[0]]
+
+		if name == "format" {
+			if _, ok := EXPORT_FORMATTERS[strings.ToLower(val)]; !ok {
+				return true, command.INVALID_ARG_VALUE, "format : " + val + ". Possible values : json/ndjson/csv/tsv"
+			}
+			opts.format = strings.ToLower(val)
+			continue
+		}
+
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			return true, command.INVALID_ARG_VALUE, name + " : " + val + ". It must be a number greater than 0."
+		}
+		if name == "batch" {
+			opts.batch = n
+		} else {
+			opts.parallel = n
+		}
+	}
+
+	expr, err := n1ql.ParseExpression(input)
+	if err != nil {
+		return true, command.INVALID_EXPRESSION, input + " : " + err.Error()
+	}
+	opts.key = expr
+
+	err_code, err_str := ImportFile(opts)
+	return true, err_code, err_str
+}
+
+/* Read the records of the file and load them into the keyspace
+   with UPSERT statements of up to opts.batch records, running
+   opts.parallel statements at a time. The file is read as the
+   statements run, so that it is never held in memory. If a
+   statement fails then each of its records is loaded on its
+   own, to find those that were rejected. If a statement cant be
+   run at all, such as when the query service cant be reached,
+   the import stops. A summary is written once done, followed by
+   the first of the rejected records.
+*/
+func ImportFile(opts *importOptions) (int, string) {
+	if NoQueryService == true {
+		//Not connected to a query service
+		return errors.NO_CONNECTION, ""
+	}
+
+	db, err := sql.Open("n1ql", ServerFlag)
+	if err != nil {
+		return errors.GO_N1QL_OPEN, ""
+	}
+
+	f, err := os.Open(opts.path)
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+	defer f.Close()
+
+	reader, err_code, err_str := newRecordReader(opts.format, f)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+
+	batches := make(chan []*importRecord, opts.parallel)
+	done := make(chan []*importRecord, opts.parallel)
+	var wg sync.WaitGroup
+
+	// Closed to stop the import on the first error that isnt
+	// returned by the query service.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var stop_code int
+	var stop_str string
+
+	// Read the file into batches, and reject the records that
+	// dont have a key.
+	var read_code int
+	var read_str string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(batches)
+
+		batch := make([]*importRecord, 0, opts.batch)
+		for seq := 1; ; seq++ {
+			record, err_code, err_str := reader.Next()
+			if err_code != 0 {
+				read_code, read_str = err_code, opts.path+" : "+err_str
+				break
+			}
+			if record == nil {
+				break
+			}
+			record.seq = seq
+
+			if record.err == "" {
+				record.key, record.err = importKey(opts.key, record.doc)
+			}
+			if record.err != "" {
+				done <- []*importRecord{record}
+				continue
+			}
+
+			batch = append(batch, record)
+			if len(batch) == opts.batch {
+				select {
+				case batches <- batch:
+				case <-stop:
+					return
+				}
+				batch = make([]*importRecord, 0, opts.batch)
+			}
+		}
+		if len(batch) > 0 {
+			select {
+			case batches <- batch:
+			case <-stop:
+			}
+		}
+	}()
+
+	for i := 0; i < opts.parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				err_code, err_str := upsertBatch(db, opts.keyspace, batch)
+				if err_code != 0 {
+					stopOnce.Do(func() {
+						stop_code, stop_str = err_code, err_str
+						close(stop)
+					})
+					return
+				}
+				done <- batch
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	progress := NewProgress()
+	total := 0
+	rejects := 0
+	var rejected []*importRecord
+	for batch := range done {
+		total += len(batch)
+		for _, record := range batch {
+			if record.err != "" {
+				rejects++
+				rejected = append(rejected, record)
+			}
+		}
+		if len(rejected) >= 2*MAX_REJECTS {
+			rejected = firstRejects(rejected)
+		}
+		progress.Add(len(batch))
+	}
+	progress.Clear()
+	rejected = firstRejects(rejected)
+
+	err_code, err_str = writeImportSummary(opts, total, rejects, rejected, time.Since(progress.start))
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	if stop_code != 0 {
+		return stop_code, stop_str
+	}
+	if read_code != 0 {
+		return read_code, read_str
+	}
+	if len(rejected) > 0 {
+		// The rejected records have been listed.
+		return command.SERVER_ERRORS, rejected[0].err
+	}
+	return 0, ""
+}
+
+/* Return the first MAX_REJECTS of the rejected records, in the
+   order they were read.
+*/
+func firstRejects(rejected []*importRecord) []*importRecord {
+	sort.Sort(bySeq(rejected))
+	if len(rejected) > MAX_REJECTS {
+		rejected = rejected[:MAX_REJECTS]
+	}
+	return rejected
+}
+
+/* Return the key of the document given by the key expression, or
+   why there isnt one.
+*/
+func importKey(key expression.Expression, doc []byte) (string, string) {
+	val, err := key.Evaluate(value.NewValue(doc), expression.NewIndexContext())
+	if err != nil {
+		return "", "key : " + err.Error()
+	}
+
+	switch val.Type() {
+	case value.STRING:
+		return val.Actual().(string), ""
+	case value.NUMBER:
+		return command.ValToStr(val), ""
+	case value.MISSING:
+		return "", "key : " + key.String() + " is MISSING"
+	}
+	return "", "key : " + key.String() + " is " + command.ValToStr(val) + ", not a string"
+}
+
+/* Load a batch of records with a single UPSERT statement. If the
+   query service returns errors then each record is loaded on its
+   own, which is safe as UPSERT can be repeated, and the errors
+   are kept in the records that were rejected. If the first record
+   fails with the same errors as the batch, then they are not due
+   to the records, and the whole batch is rejected. Any other
+   error is returned, to stop the import.
+*/
+func upsertBatch(db *sql.DB, keyspace string, batch []*importRecord) (int, string) {
+	batch_code, batch_str := upsertRecords(db, keyspace, batch)
+	if batch_code != command.SERVER_ERRORS {
+		return batch_code, batch_str
+	}
+	if len(batch) == 1 {
+		batch[0].err = importError(batch_code, batch_str)
+		return 0, ""
+	}
+
+	for i, record := range batch {
+		err_code, err_str := upsertRecords(db, keyspace, []*importRecord{record})
+		if err_code != 0 && err_code != command.SERVER_ERRORS {
+			return err_code, err_str
+		}
+
+		if i == 0 && err_str == batch_str {
+			for _, record := range batch {
+				record.err = importError(batch_code, batch_str)
+			}
+			return 0, ""
+		}
+		if err_code != 0 {
+			record.err = importError(err_code, err_str)
+		}
+	}
+	return 0, ""
+}
+
+/* Run an UPSERT statement for the records, through the same path
+   as the statements typed into the shell. Its results are not
+   written.
+*/
+func upsertRecords(db *sql.DB, keyspace string, records []*importRecord) (int, string) {
+	var buf bytes.Buffer
+	buf.WriteString("UPSERT INTO " + keyspace + " (KEY, VALUE) VALUES ")
+	for i, record := range records {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		key, _ := json.Marshal(record.key)
+		buf.WriteString("(")
+		buf.Write(key)
+		buf.WriteString(", ")
+		buf.Write(record.doc)
+		buf.WriteString(")")
+	}
+	return execFormatted(buf.String(), db, discardFormatter{}, ioutil.Discard, 0)
+}
+
+/* Return the text of an error returned for an UPSERT statement. */
+func importError(err_code int, err_str string) string {
+	if err_code == command.SERVER_ERRORS {
+		return strings.Join(messageLines(json.RawMessage(err_str), nil), "; ")
+	}
+	return command.HandleError(err_code, err_str).Error()
+}
+
+/* Write the number of records loaded, followed by the first of
+   the rejected records in the order they were read.
+*/
+func writeImportSummary(opts *importOptions, total, rejects int, rejected []*importRecord, elapsed time.Duration) (int, string) {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("Imported %d of %s into %s in %s", total-rejects, rowCount(total), opts.keyspace, formatDuration(elapsed)))
+	if rejects > len(rejected) {
+		buf.WriteString(fmt.Sprintf(", %d rejected, the first %d are :", rejects, len(rejected)))
+	} else if rejects > 0 {
+		buf.WriteString(fmt.Sprintf(", %d rejected :", rejects))
+	}
+	buf.WriteString("\n")
+
+	for _, record := range rejected {
+		doc := string(record.doc)
+		if runewidth.StringWidth(doc) > MAX_REJECT_WIDTH {
+			doc = runewidth.Truncate(doc, MAX_REJECT_WIDTH, "...")
+		}
+		buf.WriteString(record.location + " : " + record.err + "\n")
+		if doc != "" {
+			buf.WriteString("    " + doc + "\n")
+		}
+	}
+
+	_, werr := io.WriteString(noteWriter(command.W), buf.String())
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
+
+type bySeq []*importRecord
+
+func (this bySeq) Len() int           { return len(this) }
+func (this bySeq) Less(i, j int) bool { return this[i].seq < this[j].seq }
+func (this bySeq) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+
+/* The results of the UPSERT statements run by \IMPORT are not
+   written.
+*/
+type discardFormatter struct{}
+
+func (this discardFormatter) Header(requestID string, signature json.RawMessage) (int, string) {
+	return 0, ""
+}
+
+func (this discardFormatter) Row(row []byte) (int, string) {
+	return 0, ""
+}
+
+func (this discardFormatter) Messages(errs, warnings json.RawMessage) (int, string) {
+	return 0, ""
+}
+
+func (this discardFormatter) Status(status string) (int, string) {
+	return 0, ""
+}
+
+func (this discardFormatter) Metrics(metrics []byte) (int, string) {
+	return 0, ""
+}
+
+func (this discardFormatter) End() (int, string) {
+	return 0, ""
+}
+
+/* A recordReader returns the records of a file one at a time,
+   and nil once there are no more. Records that cant be read are
+   returned with an error, so that they are listed as rejected.
+   An error is only returned if the rest of the file cant be read.
+*/
+type recordReader interface {
+	Next() (*importRecord, int, string)
+}
+
+func newRecordReader(format string, r io.Reader) (recordReader, int, string) {
+	switch format {
+	case FORMAT_NDJSON:
+		return &ndjsonReader{r: bufio.NewReader(r)}, 0, ""
+	case FORMAT_CSV, FORMAT_TSV:
+		reader := csv.NewReader(r)
+		if format == FORMAT_TSV {
+			reader.Comma = '\t'
+		}
+		reader.FieldsPerRecord = -1
+		return &csvReader{r: reader, missing: currentMissing()}, 0, ""
+	default:
+		return &jsonReader{r: bufio.NewReader(r)}, 0, ""
+	}
+}
+
+/* Reads a JSON array of records, or records one after another. */
+type jsonReader struct {
+	r       *bufio.Reader
+	decoder *json.Decoder
+	array   bool
+	count   int
+}
+
+func (this *jsonReader) Next() (*importRecord, int, string) {
+	if this.decoder == nil {
+		// Look for the [ of an array.
+		for {
+			c, err := this.r.ReadByte()
+			if err == io.EOF {
+				return nil, 0, ""
+			} else if err != nil {
+				return nil, errors.READ_FILE, err.Error()
+			}
+			if !isSpace(rune(c)) {
+				this.array = c == '['
+				this.r.UnreadByte()
+				break
+			}
+		}
+
+		this.decoder = json.NewDecoder(this.r)
+		if this.array {
+			this.decoder.Token()
+		}
+	}
+
+	if this.array && !this.decoder.More() {
+		return nil, 0, ""
+	}
+
+	var doc json.RawMessage
+	err := this.decoder.Decode(&doc)
+	if err == io.EOF && !this.array {
+		return nil, 0, ""
+	}
+	this.count++
+	if err != nil {
+		return nil, errors.READ_FILE, fmt.Sprintf("record %d : %s", this.count, err.Error())
+	}
+
+	compact, err_code, err_str := compactJSON(doc)
+	if err_code != 0 {
+		return nil, err_code, err_str
+	}
+	return &importRecord{location: fmt.Sprintf("record %d", this.count), doc: compact}, 0, ""
+}
+
+/* Reads a record from each line that isnt blank. */
+type ndjsonReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (this *ndjsonReader) Next() (*importRecord, int, string) {
+	for {
+		text, err := this.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.READ_FILE, err.Error()
+		}
+		if text == "" && err == io.EOF {
+			return nil, 0, ""
+		}
+		this.line++
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		record := &importRecord{location: fmt.Sprintf("line %d", this.line), doc: []byte(text)}
+		if compact, err_code, _ := compactJSON(record.doc); err_code == 0 {
+			record.doc = compact
+		} else {
+			record.err = "invalid JSON"
+		}
+		return record, 0, ""
+	}
+}
+
+/* Reads a header line of field names, followed by a record for
+   each line, as written by the csv and tsv output formats. Dotted
+   field names such as geo.lat are loaded as nested objects. Empty
+   fields, and those that hold the missing marker, are MISSING.
+   Fields that hold a JSON number, boolean, null, array or object
+   are loaded as that value, and others as strings.
+*/
+type csvReader struct {
+	r       *csv.Reader
+	missing string
+	names   [][]string
+	count   int
+}
+
+func (this *csvReader) Next() (*importRecord, int, string) {
+	if this.names == nil {
+		header, err := this.r.Read()
+		if err == io.EOF {
+			return nil, 0, ""
+		} else if err != nil {
+			return nil, errors.READ_FILE, "header : " + err.Error()
+		}
+		this.names = make([][]string, len(header))
+		for i, name := range header {
+			this.names[i] = strings.Split(name, ".")
+		}
+	}
+
+	fields, err := this.r.Read()
+	if err == io.EOF {
+		return nil, 0, ""
+	}
+	this.count++
+	record := &importRecord{location: fmt.Sprintf("record %d", this.count)}
+	if err != nil {
+		record.err = err.Error()
+		return record, 0, ""
+	}
+	if len(fields) > len(this.names) {
+		record.doc = []byte(strings.Join(fields, string(this.r.Comma)))
+		record.err = "more fields than the header"
+		return record, 0, ""
+	}
+
+	cells := make([]json.RawMessage, len(this.names))
+	for i, field := range fields {
+		cells[i] = this.cell(field)
+	}
+	record.doc = csvObject(this.names, cells)
+	return record, 0, ""
+}
+
+/* Return the value of a field, or nil if it is MISSING. */
+func (this *csvReader) cell(field string) json.RawMessage {
+	if field == "" || (this.missing != "" && field == this.missing) {
+		return nil
+	}
+
+	trimmed := strings.TrimSpace(field)
+	if trimmed != "" && strings.IndexByte("-0123456789tfn[{", trimmed[0]) >= 0 {
+		if compact, err_code, _ := compactJSON([]byte(trimmed)); err_code == 0 {
+			return compact
+		}
+	}
+	b, _ := json.Marshal(field)
+	return b
+}
+
+/* Return the JSON object for the fields with the given names,
+   split at the dots, keeping the fields in the order of the
+   columns. A field that is also the name of an object, such as
+   geo alongside geo.lat, is used instead of the object if it is
+   not MISSING.
+*/
+func csvObject(names [][]string, cells []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	done := map[string]bool{}
+	for i, name := range names {
+		if done[name[0]] {
+			continue
+		}
+		done[name[0]] = true
+
+		// Gather the columns under this name.
+		var val json.RawMessage
+		var subNames [][]string
+		var subCells []json.RawMessage
+		for j := i; j < len(names); j++ {
+			if names[j][0] != name[0] {
+				continue
+			}
+			if len(names[j]) == 1 {
+				val = cells[j]
+			} else {
+				subNames = append(subNames, names[j][1:])
+				subCells = append(subCells, cells[j])
+			}
+		}
+		if val == nil && len(subNames) > 0 {
+			val = csvObject(subNames, subCells)
+			if string(val) == "{}" {
+				val = nil
+			}
+		}
+		if val == nil {
+			continue
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(name[0])
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(val)
+	}
+	buf.WriteString("}")
+	return buf.Bytes()
+}
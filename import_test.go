@@ -0,0 +1,93 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCSVCell(t *testing.T) {
+	reader := &csvReader{missing: "<missing>"}
+
+	tests := []struct {
+		field    string
+		expected json.RawMessage
+	}{
+		{"", nil},
+		{"<missing>", nil},
+		{"abc", json.RawMessage(`"abc"`)},
+		{" 12 ", json.RawMessage(`12`)},
+		{"-1.5", json.RawMessage(`-1.5`)},
+		{"true", json.RawMessage(`true`)},
+		{"null", json.RawMessage(`null`)},
+		{`{"a": [1, 2]}`, json.RawMessage(`{"a":[1,2]}`)},
+		{"12 Main St", json.RawMessage(`"12 Main St"`)},
+		{"nope", json.RawMessage(`"nope"`)},
+		{" ", json.RawMessage(`" "`)},
+	}
+
+	for _, test := range tests {
+		if got := reader.cell(test.field); string(got) != string(test.expected) {
+			t.Errorf("cell(%q) = %s, expected %s", test.field, got, test.expected)
+		}
+	}
+}
+
+func TestCSVObject(t *testing.T) {
+	tests := []struct {
+		header   string
+		cells    []string
+		expected string
+	}{
+		{"a,b", []string{`1`, `"x"`}, `{"a":1,"b":"x"}`},
+		{"a,b", []string{``, `"x"`}, `{"b":"x"}`},
+		{"name,geo.lat,geo.lon", []string{`"n"`, `1`, `2`}, `{"name":"n","geo":{"lat":1,"lon":2}}`},
+		{"geo.lat,name,geo.lon", []string{`1`, `"n"`, `2`}, `{"geo":{"lat":1,"lon":2},"name":"n"}`},
+		{"a,geo.lat,geo.lon", []string{`1`, ``, ``}, `{"a":1}`},
+		{"geo,geo.lat", []string{`"here"`, `1`}, `{"geo":"here"}`},
+		{"geo,geo.lat", []string{``, `1`}, `{"geo":{"lat":1}}`},
+		{"a.b.c,a.b.d,a.e", []string{`1`, `2`, `3`}, `{"a":{"b":{"c":1,"d":2},"e":3}}`},
+	}
+
+	for _, test := range tests {
+		header := strings.Split(test.header, ",")
+		names := make([][]string, len(header))
+		cells := make([]json.RawMessage, len(header))
+		for i, name := range header {
+			names[i] = strings.Split(name, ".")
+			if test.cells[i] != "" {
+				cells[i] = json.RawMessage(test.cells[i])
+			}
+		}
+
+		if got := string(csvObject(names, cells)); got != test.expected {
+			t.Errorf("csvObject(%s, %q) = %s, expected %s", test.header, test.cells, got, test.expected)
+		}
+	}
+}
+
+func TestFirstRejects(t *testing.T) {
+	var rejected []*importRecord
+	for seq := 2 * MAX_REJECTS; seq > 0; seq-- {
+		rejected = append(rejected, &importRecord{seq: seq})
+	}
+
+	first := firstRejects(rejected)
+	if len(first) != MAX_REJECTS {
+		t.Fatalf("firstRejects kept %d records, expected %d", len(first), MAX_REJECTS)
+	}
+	for i, record := range first {
+		if record.seq != i+1 {
+			t.Errorf("firstRejects record %d has seq %d, expected %d", i, record.seq, i+1)
+		}
+	}
+}
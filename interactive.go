@@ -35,11 +35,11 @@ var fgRed = "\x1b[31m"
 var first = false
 
 /* This method is used to handle user interaction with the
-   cli. After combining the multi line input, it is sent to
-   the execute_inpu method which parses and executes the
-   input command. In the event an error is returned from the
-   query execution, it is printed in red. The input prompt is
-   the name of the executable.
+   cli. After the Splitter combines the multi line input into
+   statements, each one is sent to the execute_input method
+   which parses and executes the input command. In the event an
+   error is returned from the query execution, it is printed in
+   red. The input prompt is the name of the executable.
 */
 func HandleInteractiveMode(prompt string) {
 
@@ -62,6 +62,7 @@ func HandleInteractiveMode(prompt string) {
 	/* Create a new liner */
 	var liner = liner.NewLiner()
 	defer liner.Close()
+	interactiveLiner = liner
 
 	/* Load history from Home directory
 	   TODO : Once Histfile and Histsize are introduced then change this code
@@ -75,7 +76,7 @@ func HandleInteractiveMode(prompt string) {
 	go signalCatcher(liner)
 
 	// state for reading a multi-line query
-	inputLine := []string{}
+	splitter := NewSplitter()
 	fullPrompt := prompt + QRY_PROMPT1
 	for {
 		line, err := liner.Prompt(fullPrompt)
@@ -91,7 +92,7 @@ func HandleInteractiveMode(prompt string) {
 		/* Check for shell comments : -- and #. Add them to the history
 		   but do not send them to be parsed.
 		*/
-		if strings.HasPrefix(line, "--") || strings.HasPrefix(line, "#") {
+		if !splitter.Pending() && (strings.HasPrefix(line, "--") || strings.HasPrefix(line, "#")) {
 			err_code, err_string := UpdateHistory(liner, homeDir, line)
 			if err_code != 0 {
 				s_err := command.HandleError(err_code, err_string)
@@ -101,81 +102,106 @@ func HandleInteractiveMode(prompt string) {
 			continue
 		}
 
-		// Building query string mode: set prompt, gather current line
-		fullPrompt = QRY_PROMPT2
-		inputLine = append(inputLine, line)
-
-		/* If the current line ends with a QRY_EOL, join all query lines,
-		   trim off trailing QRY_EOL characters, and submit the query string.
+		/* The splitter returns every statement completed by the
+		   current line, and submits each of them in turn. If part
+		   of a statement is left over then keep gathering lines.
 		*/
-		if strings.HasSuffix(line, QRY_EOL) {
-			inputString := strings.Join(inputLine, " ")
-			for strings.HasSuffix(inputString, QRY_EOL) {
-				inputString = strings.TrimSuffix(inputString, QRY_EOL)
-			}
-			if inputString != "" {
-				err_code, err_string := UpdateHistory(liner, homeDir, inputString+QRY_EOL)
-				if err_code != 0 {
-					s_err := command.HandleError(err_code, err_string)
-					command.PrintError(s_err)
-				}
-				err_code, err_string = execute_input(inputString, os.Stdout)
-				/* Error handling for Shell errors and errors recieved from
-				   go_n1ql.
-				*/
-				if err_code != 0 {
-					s_err := command.HandleError(err_code, err_string)
-					if err_code == errors.GON1QL_QUERY {
-						//Dont print the error code for query errors.
-						tmpstr := fmt.Sprintln(fgRed, s_err, reset)
-						io.WriteString(command.W, tmpstr+"\n")
-
-					} else {
-						command.PrintError(s_err)
-					}
+		for _, stmt := range splitter.Feed(line) {
+			inputString := stmt.Text
 
-					if *errorExitFlag == true {
-						if first == false {
-							first = true
-							_, werr := io.WriteString(command.W, "Exiting on first error encountered\n")
-							if werr != nil {
-								s_err = command.HandleError(errors.WRITER_OUTPUT, werr.Error())
-								command.PrintError(s_err)
-							}
-							liner.Close()
-							os.Clearenv()
-							os.Exit(1)
+			err_code, err_string := UpdateHistory(liner, homeDir, inputString+QRY_EOL)
+			if err_code != 0 {
+				s_err := command.HandleError(err_code, err_string)
+				command.PrintError(s_err)
+			}
+			echoStmt(inputString)
+			err_code, err_string = execute_logged(inputString, OUTPUT)
+			/* Error handling for Shell errors and errors recieved from
+			   go_n1ql.
+			*/
+			if err_code != 0 {
+				printExecError(err_code, err_string)
+
+				if *errorExitFlag == true {
+					if first == false {
+						first = true
+						_, werr := io.WriteString(command.W, "Exiting on first error encountered\n")
+						if werr != nil {
+							s_err := command.HandleError(errors.WRITER_OUTPUT, werr.Error())
+							command.PrintError(s_err)
 						}
+						liner.Close()
+						os.Clearenv()
+						os.Exit(exitCode(err_code, err_string))
 					}
 				}
+			}
 
-				/* For the \EXIT and \QUIT shell commands we need to
-				   make sure that we close the liner and then exit. In
-				   the event an error is returned from execute_input after
-				   the \EXIT command, then handle the error and exit with
-				   exit code 1 (which is for general errors).
-				*/
-				if EXIT == true {
-					command.EXIT = false
-					liner.Close()
-					if err == nil {
-						os.Exit(0)
-					} else {
-						os.Exit(1)
-					}
-
+			/* For the \EXIT and \QUIT shell commands we need to
+			   make sure that we close the liner and then exit. In
+			   the event an error is returned from execute_input after
+			   the \EXIT command, then handle the error and exit with
+			   exit code 1 (which is for general errors).
+			*/
+			if EXIT == true {
+				command.EXIT = false
+				liner.Close()
+				if err == nil {
+					os.Exit(0)
+				} else {
+					os.Exit(1)
 				}
 
 			}
+		}
 
-			// reset state for multi-line query
-			inputLine = []string{}
+		// Set the prompt depending on whether a statement is still being built.
+		if splitter.Pending() {
+			fullPrompt = QRY_PROMPT2
+		} else {
 			fullPrompt = prompt + QRY_PROMPT1
 		}
 	}
 
 }
 
+/* The liner used by HandleInteractiveMode, if the shell is
+   interactive. It puts the terminal into raw mode, so it must be
+   closed before the shell exits.
+*/
+var interactiveLiner *liner.State
+
+/* Exit the shell from within a statement, such as an \EXIT in a
+   file run by \SOURCE, restoring the terminal first.
+*/
+func exitShell(code int) {
+	if interactiveLiner != nil {
+		interactiveLiner.Close()
+	}
+	os.Exit(code)
+}
+
+/* Print the error returned by execute_input in red. The error
+   code is not printed for query errors, and the errors returned
+   by the query service are not printed again, as they have been
+   written with the results.
+*/
+func printExecError(err_code int, err_string string) {
+	if err_code == command.SERVER_ERRORS {
+		return
+	}
+
+	s_err := command.HandleError(err_code, err_string)
+	if err_code == errors.GON1QL_QUERY {
+		//Dont print the error code for query errors.
+		tmpstr := fmt.Sprintln(fgRed, s_err, reset)
+		io.WriteString(command.W, tmpstr+"\n")
+
+	} else {
+		command.PrintError(s_err)
+	}
+}
+
 /* If ^C is pressed then Abort the shell. This is
    provided by the liner package.
 */
@@ -0,0 +1,117 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* The Interpolate method replaces each reference ${name} to a
+   user defined session variable in the input with the top value
+   of its stack. The name must be an identifier. Values are
+   substituted as JSON, so that strings such as dates are quoted
+   and can be used as N1QL values. Inside an escaped identifier,
+   such as `${ks}`, a string is substituted without its quotes and
+   with any ` doubled, so that variables can be used for names
+   such as beer-sample. References inside string literals and
+   comments are left as they are, as is a ${ that does not start
+   a reference. A reference preceded by a \ is not replaced, so
+   \${name} becomes ${name}.
+*/
+func Interpolate(line string) (string, int, string) {
+	var buf bytes.Buffer
+	var lex lexer
+
+	input := []rune(line)
+	for i, n := 0, 0; i < len(input); i += n {
+		name, end := "", 0
+		ident := lex.state == SPLIT_QUOTE && lex.quote == '`' && !lex.escaped
+
+		if lex.state == SPLIT_NORMAL && input[i] == '\\' {
+			if _, end := reference(input, i+1); end > 0 {
+				// Escaped reference
+				buf.WriteString(string(input[i+1 : end]))
+				n = end - i
+				continue
+			}
+		}
+		if lex.state == SPLIT_NORMAL || ident {
+			name, end = reference(input, i)
+		}
+
+		if end > 0 {
+			text, err_code, err_str := variableText(name, ident)
+			if err_code != 0 {
+				return "", err_code, err_str
+			}
+			buf.WriteString(text)
+			n = end - i
+			continue
+		}
+
+		n, _ = lex.next(input, i, false)
+		buf.WriteString(string(input[i : i+n]))
+	}
+
+	return buf.String(), 0, ""
+}
+
+/* Return the text that replaces a reference to the variable, as
+   JSON, or as the inside of an escaped identifier if ident is
+   true.
+*/
+func variableText(name string, ident bool) (string, int, string) {
+	v, ok := command.UserDefSV[name]
+	if !ok {
+		return "", errors.NO_SUCH_PARAM, " $" + name + " "
+	}
+
+	val, err_code, err_str := v.Top()
+	if err_code != 0 {
+		return "", err_code, err_str
+	}
+
+	if !ident {
+		return command.ValToStr(val), 0, ""
+	}
+	text := command.ValToStr(val)
+	if val.Type() == value.STRING {
+		text = val.Actual().(string)
+	}
+	return strings.Replace(text, "`", "``", -1), 0, ""
+}
+
+/* If a reference ${name} starts at input[i], return the name and
+   the index just after the reference. Otherwise the index is 0.
+*/
+func reference(input []rune, i int) (string, int) {
+	if i+1 >= len(input) || input[i] != '$' || input[i+1] != '{' {
+		return "", 0
+	}
+
+	start := i + 2
+	for j := start; j < len(input); j++ {
+		c := input[j]
+		switch {
+		case c == '}' && j > start:
+			return string(input[start:j]), j + 1
+		case unicode.IsLetter(c) || c == '_' || (unicode.IsDigit(c) && j > start):
+		default:
+			return "", 0
+		}
+	}
+	return "", 0
+}
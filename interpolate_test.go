@@ -0,0 +1,69 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]interface{}{
+		"ks":    "beer-sample",
+		"since": "2024-01-01",
+		"odd":   "a`b",
+		"count": 10,
+		"ok":    true,
+	}
+	for name, v := range vars {
+		if err_code, err_str := command.PushOrSetValue("$"+name, value.NewValue(v), false); err_code != 0 {
+			t.Fatalf("push $%s : %d %s", name, err_code, err_str)
+		}
+	}
+	defer func() {
+		for name := range vars {
+			command.PopValue_Helper(false, command.UserDefSV, name)
+		}
+	}()
+
+	tests := []struct {
+		line     string
+		expected string
+		err_code int
+	}{
+		{"select 1", "select 1", 0},
+		{"select * from `${ks}`", "select * from `beer-sample`", 0},
+		{"select * from `${ks}` where d > ${since} limit ${count}",
+			"select * from `beer-sample` where d > \"2024-01-01\" limit 10", 0},
+		{"select * from default:`${ks}`.`s${count}`", "select * from default:`beer-sample`.`s10`", 0},
+		{"select * from `${odd}`", "select * from `a``b`", 0},
+		{"${ok}${count}", "true10", 0},
+		{"select '${ks}', \"${ks}\"", "select '${ks}', \"${ks}\"", 0},
+		{"select '${'", "select '${'", 0},
+		{"select 1 /* ${ks} */ -- ${ks}", "select 1 /* ${ks} */ -- ${ks}", 0},
+		{`select \${ks}`, "select ${ks}", 0},
+		{`select \$`, `select \$`, 0},
+		{"select ${", "select ${", 0},
+		{"select ${ ks }, ${1a}, ${}", "select ${ ks }, ${1a}, ${}", 0},
+		{"select ${nosuch}", "", errors.NO_SUCH_PARAM},
+		{"select `${nosuch}`", "", errors.NO_SUCH_PARAM},
+	}
+
+	for _, test := range tests {
+		got, err_code, _ := Interpolate(test.line)
+		if got != test.expected || err_code != test.err_code {
+			t.Errorf("Interpolate(%q) = %q, %d, expected %q, %d",
+				test.line, got, err_code, test.expected, test.err_code)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* Return the maximum number of results to show for a statement,
+   given by the limit predefined session variable. 0 means that
+   there is no limit.
+*/
+func currentLimit() (int, int, string) {
+	v, err_code, _ := command.PreDefSV["limit"].Top()
+	if err_code != 0 {
+		return 0, 0, ""
+	}
+
+	if v.Type() == value.NUMBER {
+		switch limit := v.Actual().(type) {
+		case int64:
+			if limit >= 0 {
+				return int(limit), 0, ""
+			}
+		case float64:
+			if limit >= 0 && limit == float64(int(limit)) {
+				return int(limit), 0, ""
+			}
+		}
+	}
+	return 0, command.INVALID_ARG_VALUE, "limit : " + command.ValToStr(v) + ". It must be a number of rows, or 0 for no limit."
+}
+
+/* Add a LIMIT to a SELECT statement that has neither a LIMIT nor
+   an OFFSET of its own, so that the query service doesnt return
+   more results than will be shown. One more result than the limit
+   is asked for, to know if there were more. Other statements are
+   left as they are, and their results are cut off as they are
+   read.
+*/
+func addLimit(stmt string, limit int) string {
+	if limit <= 0 {
+		return stmt
+	}
+
+	words := topLevelWords(stmt)
+	if len(words) == 0 || words[0] != "select" {
+		return stmt
+	}
+	for _, word := range words {
+		if word == "limit" || word == "offset" {
+			return stmt
+		}
+	}
+
+	// Start a new line in case the statement ends in a comment.
+	stmt = strings.TrimRight(stmt, "; \t\r\n")
+	return stmt + "\nLIMIT " + strconv.Itoa(limit+1)
+}
+
+/* Return the lower case words of the statement that are not in a
+   string, an escaped identifier, a comment or parentheses.
+*/
+func topLevelWords(stmt string) []string {
+	var words []string
+	var word []rune
+
+	endWord := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	input := []rune(stmt)
+	depth := 0
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			endWord()
+			for i++; i < len(input) && input[i] != c; i++ {
+				if input[i] == '\\' {
+					i++
+				}
+			}
+
+		case c == '-' && i+1 < len(input) && input[i+1] == '-':
+			endWord()
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < len(input) && input[i+1] == '*':
+			endWord()
+			for i += 2; i+1 < len(input) && !(input[i] == '*' && input[i+1] == '/'); i++ {
+			}
+			i++
+
+		case c == '(' || c == '[' || c == '{':
+			endWord()
+			depth++
+
+		case c == ')' || c == ']' || c == '}':
+			endWord()
+			depth--
+
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			if depth == 0 {
+				word = append(word, c)
+			}
+
+		default:
+			endWord()
+		}
+	}
+	endWord()
+	return words
+}
+
+/* Print a note that only some of the results were shown. The
+   results are not read past the limit, so the number of results
+   is only known to be more than the number shown.
+*/
+func writeLimitNote(w io.Writer, shown int) error {
+	_, err := io.WriteString(w, fmt.Sprintf("showing the first %d rows, there are more. Use \\SET limit 0; to show all the rows.\n", shown))
+	return err
+}
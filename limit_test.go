@@ -0,0 +1,60 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddLimit(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		limit    int
+		expected string
+	}{
+		{"select * from b", 0, "select * from b"},
+		{"select * from b", 10, "select * from b\nLIMIT 11"},
+		{"SELECT * FROM b ; ", 1, "SELECT * FROM b\nLIMIT 2"},
+		{"select * from b -- all of it", 5, "select * from b -- all of it\nLIMIT 6"},
+		{"select * from b limit 3", 10, "select * from b limit 3"},
+		{"select * from b OFFSET 3", 10, "select * from b OFFSET 3"},
+		{"select * from (select * from b limit 3) s", 10, "select * from (select * from b limit 3) s\nLIMIT 11"},
+		{"select 'limit' from b", 10, "select 'limit' from b\nLIMIT 11"},
+		{"insert into b values ('k', {})", 10, "insert into b values ('k', {})"},
+		{"explain select * from b", 10, "explain select * from b"},
+	}
+
+	for _, test := range tests {
+		if got := addLimit(test.stmt, test.limit); got != test.expected {
+			t.Errorf("addLimit(%q, %d) = %q, expected %q", test.stmt, test.limit, got, test.expected)
+		}
+	}
+}
+
+func TestTopLevelWords(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected []string
+	}{
+		{"", nil},
+		{"SELECT a, b_1 FROM b", []string{"select", "a", "b_1", "from", "b"}},
+		{"select count(*) from b", []string{"select", "count", "from", "b"}},
+		{`select "limit", 'it\'s', ` + "`offset`" + ` from b`, []string{"select", "from", "b"}},
+		{"select a /* limit */ from b -- offset\nwhere c", []string{"select", "a", "from", "b", "where", "c"}},
+		{"select [x limit] from {y: (z)} w", []string{"select", "from", "w"}},
+	}
+
+	for _, test := range tests {
+		if got := topLevelWords(test.stmt); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("topLevelWords(%q) = %q, expected %q", test.stmt, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+/* An error or warning returned by the query service. Only the
+   fields that are listed readably are decoded, the formatters
+   are passed the objects as they were returned.
+*/
+type ServerMessage struct {
+	Code  int    `json:"code"`
+	Msg   string `json:"msg"`
+	Retry bool   `json:"retry"`
+}
+
+/* The parts of a response from the query service that are kept
+   when a statement fails.
+*/
+type queryResponse struct {
+	RequestID string
+	Errors    json.RawMessage
+	Warnings  json.RawMessage
+	Status    string
+	Metrics   json.RawMessage
+}
+
+/* go_n1ql returns the body of the response as the error when the
+   query service doesnt return 200, and only the first part of it
+   if it is long. Return the fields of the response that could be
+   read. Returns false if the error does not hold any errors from
+   the query service, such as when it cant be reached.
+*/
+func parseQueryError(msg string) (*queryResponse, bool) {
+	start := strings.IndexByte(msg, '{')
+	if start < 0 {
+		return nil, false
+	}
+
+	response := &queryResponse{}
+	decoder := json.NewDecoder(strings.NewReader(msg[start:]))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+
+	// Keep each field until the first one that was cut off.
+	for decoder.More() {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		name, _ := tok.(string)
+
+		var val json.RawMessage
+		if err := decoder.Decode(&val); err != nil {
+			break
+		}
+
+		switch name {
+		case "requestID":
+			json.Unmarshal(val, &response.RequestID)
+		case "errors":
+			response.Errors = val
+		case "warnings":
+			response.Warnings = val
+		case "status":
+			json.Unmarshal(val, &response.Status)
+		case "metrics":
+			response.Metrics = val
+		}
+	}
+
+	if !hasMessages(response.Errors) {
+		return nil, false
+	}
+	if response.Status == "" {
+		response.Status = "fatal"
+	}
+	return response, true
+}
+
+/* Return true if the errors or warnings hold at least one message. */
+func hasMessages(messages json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(messages)
+	return len(trimmed) > 0 && string(trimmed) != "null" && string(trimmed) != "[]"
+}
+
+/* Return a line for each of the errors and warnings, such as
+   error 3000 : syntax error - at end of input
+   warning 4000 : the index is not up to date (retry)
+*/
+func messageLines(errs, warnings json.RawMessage) []string {
+	var lines []string
+	lines = append(lines, messageList("error", errs)...)
+	lines = append(lines, messageList("warning", warnings)...)
+	return lines
+}
+
+func messageList(kind string, messages json.RawMessage) []string {
+	if !hasMessages(messages) {
+		return nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(messages, &list); err != nil {
+		// A single message that is not in an array.
+		list = []json.RawMessage{messages}
+	}
+
+	lines := make([]string, 0, len(list))
+	for _, raw := range list {
+		var message ServerMessage
+		if err := json.Unmarshal(raw, &message); err != nil || message.Msg == "" {
+			lines = append(lines, kind+" : "+valueText(raw))
+			continue
+		}
+
+		line := kind
+		if message.Code != 0 {
+			line += " " + strconv.Itoa(message.Code)
+		}
+		line += " : " + message.Msg
+		if message.Retry {
+			line += " (retry)"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
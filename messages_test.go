@@ -0,0 +1,86 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQueryError(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		ok       bool
+		expected queryResponse
+	}{
+		{
+			name: "whole response",
+			msg: `N1QL: 400 Bad Request {"requestID": "r1", "errors": [{"code": 3000, "msg": "syntax error"}],` +
+				` "status": "errors", "metrics": {"elapsedTime": "1ms"}}`,
+			ok: true,
+			expected: queryResponse{
+				RequestID: "r1",
+				Errors:    []byte(`[{"code": 3000, "msg": "syntax error"}]`),
+				Status:    "errors",
+				Metrics:   []byte(`{"elapsedTime": "1ms"}`),
+			},
+		},
+		{
+			name: "response cut off in the metrics",
+			msg:  `{"requestID": "r2", "errors": [{"code": 5000, "msg": "x"}], "warnings": [], "metrics": {"elapsed`,
+			ok:   true,
+			expected: queryResponse{
+				RequestID: "r2",
+				Errors:    []byte(`[{"code": 5000, "msg": "x"}]`),
+				Warnings:  []byte(`[]`),
+				Status:    "fatal",
+			},
+		},
+		{
+			name: "response cut off in the errors",
+			msg:  `{"requestID": "r3", "errors": [{"code": 5000, "msg": "x"`,
+		},
+		{
+			name: "no errors",
+			msg:  `{"requestID": "r4", "errors": [], "status": "success"}`,
+		},
+		{
+			name: "not a response",
+			msg:  "dial tcp 127.0.0.1:8093: connection refused",
+		},
+	}
+
+	for _, test := range tests {
+		response, ok := parseQueryError(test.msg)
+		if ok != test.ok {
+			t.Errorf("%s : ok = %v, expected %v", test.name, ok, test.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(*response, test.expected) {
+			t.Errorf("%s : got %+v, expected %+v", test.name, *response, test.expected)
+		}
+	}
+}
+
+func TestMessageLines(t *testing.T) {
+	errs := []byte(`[{"code": 3000, "msg": "syntax error"}, {"msg": "no code", "retry": true}, "plain"]`)
+	warnings := []byte(`{"code": 4000, "msg": "one warning"}`)
+	expected := []string{
+		"error 3000 : syntax error",
+		"error : no code (retry)",
+		"error : plain",
+		"warning 4000 : one warning",
+	}
+
+	if got := messageLines(errs, warnings); !reflect.DeepEqual(got, expected) {
+		t.Errorf("messageLines = %q, expected %q", got, expected)
+	}
+}
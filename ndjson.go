@@ -0,0 +1,102 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/couchbase/query/errors"
+)
+
+/* The NDJSON formatter writes each result on its own line as
+   soon as it is read, so that the output can be streamed into
+   tools such as jq. The request id, signature, errors, warnings,
+   status and metrics are written as a single JSON object to
+   os.Stderr once the results are done, so that the output only
+   holds results. On a terminal the results are coloured by the
+   current theme.
+*/
+type NDJSONFormatter struct {
+	w     io.Writer
+	meta  io.Writer
+	theme *Theme
+
+	requestID string
+	signature json.RawMessage
+	errors    json.RawMessage
+	warnings  json.RawMessage
+	status    string
+	metrics   json.RawMessage
+}
+
+func NewNDJSONFormatter(w io.Writer) Formatter {
+	return &NDJSONFormatter{w: w, meta: os.Stderr, theme: resultTheme(w)}
+}
+
+func (this *NDJSONFormatter) Header(requestID string, signature json.RawMessage) (int, string) {
+	this.requestID = requestID
+	this.signature = signature
+	return 0, ""
+}
+
+func (this *NDJSONFormatter) Row(row []byte) (int, string) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, row); err != nil {
+		return errors.JSON_UNMARSHAL, err.Error()
+	}
+	buf.WriteByte('\n')
+
+	_, werr := this.w.Write(colorJSON(buf.Bytes(), this.theme))
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
+
+func (this *NDJSONFormatter) Messages(errs, warnings json.RawMessage) (int, string) {
+	this.errors = errs
+	this.warnings = warnings
+	return 0, ""
+}
+
+func (this *NDJSONFormatter) Status(status string) (int, string) {
+	this.status = status
+	return 0, ""
+}
+
+func (this *NDJSONFormatter) Metrics(metrics []byte) (int, string) {
+	this.metrics = metrics
+	return 0, ""
+}
+
+func (this *NDJSONFormatter) End() (int, string) {
+	meta := struct {
+		RequestID string          `json:"requestID,omitempty"`
+		Signature json.RawMessage `json:"signature,omitempty"`
+		Errors    json.RawMessage `json:"errors,omitempty"`
+		Warnings  json.RawMessage `json:"warnings,omitempty"`
+		Status    string          `json:"status,omitempty"`
+		Metrics   json.RawMessage `json:"metrics,omitempty"`
+	}{this.requestID, this.signature, this.errors, this.warnings, this.status, this.metrics}
+
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return errors.JSON_MARSHAL, err.Error()
+	}
+
+	_, werr := this.meta.Write(append(b, '\n'))
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
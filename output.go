@@ -0,0 +1,110 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* OUTPUT is the writer that statements and their results are sent
+   to. It is os.Stdout, unless a file is given using the -output
+   option or the \REDIRECT command, in which case the output is
+   written to both the file and os.Stdout.
+*/
+var (
+	OUTPUT io.Writer = os.Stdout
+
+	outputFile   *os.File
+	redirectFile *os.File
+)
+
+/* Send all output to the file given by the -output option. The
+   file is truncated if it exists.
+*/
+func SetOutputFile(path string) (int, string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+	outputFile = f
+	setOutput(f)
+	return 0, ""
+}
+
+/* Handle the \REDIRECT command. Output is appended to the input
+   file until \REDIRECT OFF, which goes back to the -output file
+   or os.Stdout only. OFF is matched in any case, like the other
+   keywords of the shell. A file named off can be given as ./off.
+*/
+func RedirectOutput(path string) (int, string) {
+	if redirectFile != nil {
+		err := redirectFile.Close()
+		redirectFile = nil
+		if err != nil {
+			return errors.FILE_CLOSE, err.Error()
+		}
+	}
+
+	if strings.EqualFold(path, "OFF") {
+		setOutput(outputFile)
+		return 0, ""
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+	redirectFile = f
+	setOutput(f)
+	return 0, ""
+}
+
+/* Send the output to both the file and os.Stdout, or to os.Stdout
+   alone if there is no file.
+*/
+func setOutput(f *os.File) {
+	if f == nil {
+		OUTPUT = os.Stdout
+	} else {
+		OUTPUT = io.MultiWriter(f, os.Stdout)
+	}
+	command.W = OUTPUT
+}
+
+/* Return the file that the output is being sent to, or nil if it
+   only goes to os.Stdout.
+*/
+func currentOutputFile() *os.File {
+	if redirectFile != nil {
+		return redirectFile
+	}
+	return outputFile
+}
+
+/* When the output is sent to a file, write the statement to it
+   as well, so that each result follows the statement it is for.
+   The statement is already on the terminal, so it is only written
+   to the file. Statements are not written in the data formats
+   such as csv.
+*/
+func echoStmt(stmt string) {
+	if f := currentOutputFile(); f != nil && !isDataFormat(currentFormat()) {
+		_, werr := io.WriteString(f, stmt+QRY_EOL+"\n")
+		if werr != nil {
+			s_err := command.HandleError(errors.WRITER_OUTPUT, werr.Error())
+			command.PrintError(s_err)
+		}
+	}
+}
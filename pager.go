@@ -0,0 +1,428 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+/* Values of the pager predefined session variable. With auto
+   the results are only paged if they dont fit on the screen.
+*/
+const (
+	PAGER_ON   = "on"
+	PAGER_OFF  = "off"
+	PAGER_AUTO = "auto"
+)
+
+/* Environment variable that gives the pager command. */
+const PAGER_ENV = "PAGER"
+
+/* A Pager sends the results of a statement through a pager when
+   they are written to a terminal. The output is kept until it is
+   taller than the terminal, and is then sent to the command given
+   by $PAGER along with the rest of the output. If $PAGER is not
+   set, the output is shown by the built in pager as it is written
+   instead, which keeps the lines read so far so that they can be
+   scrolled back over. Output that is not
+   paged is written to w by Close. Output that is not written to a
+   terminal, such as that sent to a file with -output or
+   \REDIRECT, is never paged.
+*/
+type Pager struct {
+	w      io.Writer
+	mode   string
+	width  int
+	height int
+
+	buf     bytes.Buffer
+	counted int
+	lines   int
+	paging  bool
+
+	cmd    *exec.Cmd
+	pipe   io.WriteCloser
+	closed bool
+
+	state   *terminal.State
+	partial []byte
+	seen    [][]byte
+	shown   int
+	rows    int
+	quit    bool
+}
+
+/* Return a Pager for the output w. If the output should not be
+   paged then Writes go straight to w.
+*/
+func NewPager(w io.Writer) (*Pager, int, string) {
+	mode, err_code, err_str := currentPager()
+	if err_code != 0 {
+		return nil, err_code, err_str
+	}
+
+	this := &Pager{w: w, mode: mode}
+	if mode == PAGER_OFF || w != io.Writer(os.Stdout) || !isTerminal(os.Stdin) {
+		this.mode = PAGER_OFF
+		return this, 0, ""
+	}
+
+	this.width, this.height = terminalSize(w)
+	if this.height <= 1 {
+		this.mode = PAGER_OFF
+	}
+	return this, 0, ""
+}
+
+func (this *Pager) Write(p []byte) (int, error) {
+	if this.mode == PAGER_OFF {
+		return this.w.Write(p)
+	}
+
+	// If the pager has been closed by the user, drop the rest.
+	if this.pipe != nil {
+		if !this.closed {
+			if _, err := this.pipe.Write(p); err != nil {
+				this.closed = true
+			}
+		}
+		return len(p), nil
+	}
+
+	if this.state != nil {
+		return len(p), this.page(p)
+	}
+
+	this.buf.Write(p)
+	rest := this.buf.Bytes()[this.counted:]
+	for i := bytes.IndexByte(rest, '\n'); i >= 0; i = bytes.IndexByte(rest, '\n') {
+		this.lines += this.screenRows(rest[:i])
+		this.counted += i + 1
+		rest = rest[i+1:]
+	}
+
+	if !this.paging && (this.mode == PAGER_ON || this.lines >= this.height) {
+		this.paging = true
+		this.startCommand()
+		if this.cmd == nil {
+			return len(p), this.startBuiltin()
+		}
+	}
+	return len(p), nil
+}
+
+/* Wait for the pager to be done with the output. */
+func (this *Pager) Close() (int, string) {
+	if this.mode == PAGER_OFF {
+		return 0, ""
+	}
+
+	if this.cmd != nil {
+		this.pipe.Close()
+		this.cmd.Wait()
+		return 0, ""
+	}
+
+	if this.state != nil {
+		err := this.end()
+		terminal.Restore(int(os.Stdin.Fd()), this.state)
+		if err != nil {
+			return errors.WRITER_OUTPUT, err.Error()
+		}
+		return 0, ""
+	}
+
+	_, werr := this.w.Write(this.buf.Bytes())
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
+
+/* Start the command given by $PAGER and send it the output so
+   far. If it isnt set, or cant be started, the output is left for
+   the built in pager.
+*/
+func (this *Pager) startCommand() {
+	pager := strings.TrimSpace(os.Getenv(PAGER_ENV))
+	if pager == "" {
+		return
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", pager)
+	} else {
+		cmd = exec.Command("sh", "-c", pager)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Let less show the colours of the results.
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(os.Environ(), "LESS=R")
+	}
+
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		return
+	}
+
+	this.cmd = cmd
+	this.pipe = pipe
+	pipe.Write(this.buf.Bytes())
+	this.buf.Reset()
+}
+
+/* Keys and escape sequences used by the built in pager. */
+const (
+	KEY_CTRL_C   = "\x03"
+	CLEAR_LINE   = "\r\x1b[K"
+	CLEAR_SCREEN = "\x1b[H\x1b[2J"
+)
+
+/* Start the built in pager, which works like less : the output
+   is written a screen at a time, and after each screen a : prompt
+   waits for space, f or page down for the next screen, enter, j
+   or down for the next line, b or page up for the previous
+   screen, k or up for the previous line, and q to quit. Once the
+   output ends, the (END) prompt takes the same keys, and the
+   keys that go forward leave the pager. The terminal is put into
+   raw mode until Close, so that the keys can be read as they are
+   pressed. If that fails the output is written as is.
+*/
+func (this *Pager) startBuiltin() error {
+	state, err := terminal.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		this.mode = PAGER_OFF
+		_, err = this.w.Write(this.buf.Bytes())
+		this.buf.Reset()
+		return err
+	}
+
+	this.state = state
+	output := this.buf.Bytes()
+	this.buf = bytes.Buffer{}
+	return this.page(output)
+}
+
+/* Keep the complete lines of p, and show those that fit on the
+   screen.
+*/
+func (this *Pager) page(p []byte) error {
+	if this.quit {
+		return nil
+	}
+
+	this.partial = append(this.partial, p...)
+	for {
+		i := bytes.IndexByte(this.partial, '\n')
+		if i < 0 {
+			break
+		}
+		this.seen = append(this.seen, append([]byte(nil), this.partial[:i]...))
+		this.partial = this.partial[i+1:]
+	}
+	return this.fill()
+}
+
+/* Write the lines that have not been shown yet, stopping at the
+   prompt each time the screen is full.
+*/
+func (this *Pager) fill() error {
+	for !this.quit && this.shown < len(this.seen) {
+		if err := this.writeLine(this.seen[this.shown]); err != nil {
+			return err
+		}
+		this.shown++
+
+		if this.rows >= this.height-1 {
+			if _, err := this.prompt(":"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/* Show the rest of the output, and wait at the (END) prompt
+   until the user leaves the pager.
+*/
+func (this *Pager) end() error {
+	if len(this.partial) > 0 {
+		this.seen = append(this.seen, this.partial)
+		this.partial = nil
+	}
+
+	for !this.quit {
+		if err := this.fill(); err != nil {
+			return err
+		}
+		if this.quit {
+			break
+		}
+
+		forward, err := this.prompt("(END)")
+		if err != nil {
+			return err
+		}
+		if forward && this.shown == len(this.seen) {
+			this.quit = true
+		}
+	}
+	return nil
+}
+
+/* Write a line to the terminal. In raw mode a line break does not
+   return to the start of the line, so \r\n is written.
+*/
+func (this *Pager) writeLine(line []byte) error {
+	if _, err := this.w.Write(line); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(this.w, "\r\n"); err != nil {
+		return err
+	}
+	this.rows += this.screenRows(line)
+	return nil
+}
+
+/* Wait at the prompt for a key that goes forward or quits, and
+   set the number of rows that can be written before the next
+   prompt. The keys that go back redraw the screen and wait for
+   the next key. The first return value is true if the key went
+   forward.
+*/
+func (this *Pager) prompt(text string) (bool, error) {
+	key := make([]byte, 8)
+	for {
+		if _, err := io.WriteString(this.w, text); err != nil {
+			return false, err
+		}
+		n, err := os.Stdin.Read(key)
+		if _, werr := io.WriteString(this.w, CLEAR_LINE); werr != nil {
+			return false, werr
+		}
+		if err != nil || n == 0 {
+			this.quit = true
+			return false, nil
+		}
+
+		switch string(key[:n]) {
+		case "q", "Q", KEY_CTRL_C:
+			this.quit = true
+			return false, nil
+		case " ", "f", "\x1b[6~":
+			this.rows = 0
+			return true, nil
+		case "\r", "\n", "j", "\x1b[B":
+			this.rows = this.height - 2
+			return true, nil
+		case "b", "\x1b[5~":
+			top := this.lineBefore(this.shown, this.height-1)
+			if err := this.redraw(this.lineBefore(top, this.height-1)); err != nil {
+				return false, err
+			}
+		case "k", "\x1b[A":
+			top := this.lineBefore(this.shown, this.height-1)
+			if top > 0 {
+				top--
+			}
+			if err := this.redraw(top); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+/* Clear the terminal and write a screen of the lines read so far,
+   starting with the line top.
+*/
+func (this *Pager) redraw(top int) error {
+	if _, err := io.WriteString(this.w, CLEAR_SCREEN); err != nil {
+		return err
+	}
+
+	this.rows = 0
+	this.shown = top
+	for this.shown < len(this.seen) && this.rows < this.height-1 {
+		if err := this.writeLine(this.seen[this.shown]); err != nil {
+			return err
+		}
+		this.shown++
+	}
+	return nil
+}
+
+/* Return the first of the lines before the line end that fit in
+   the given number of rows.
+*/
+func (this *Pager) lineBefore(end, rows int) int {
+	for end > 0 {
+		rows -= this.screenRows(this.seen[end-1])
+		if rows < 0 {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+/* Return the number of rows that a line takes up on the terminal,
+   once it is wrapped to its width.
+*/
+func (this *Pager) screenRows(line []byte) int {
+	width := coloredWidth(string(line))
+	if this.width <= 0 || width <= this.width {
+		return 1
+	}
+	return (width + this.width - 1) / this.width
+}
+
+/* Return the pager mode, given by the pager predefined session
+   variable.
+*/
+func currentPager() (string, int, string) {
+	v, err_code, _ := command.PreDefSV["pager"].Top()
+	if err_code != 0 {
+		return PAGER_AUTO, 0, ""
+	}
+
+	mode := command.ValToStr(v)
+	if v.Type() == value.STRING {
+		mode = v.Actual().(string)
+	} else if v.Type() == value.BOOLEAN {
+		// \SET pager true and false
+		if v.Truth() {
+			mode = PAGER_ON
+		} else {
+			mode = PAGER_OFF
+		}
+	}
+
+	switch strings.ToLower(mode) {
+	case PAGER_ON, PAGER_OFF, PAGER_AUTO:
+		return strings.ToLower(mode), 0, ""
+	}
+	return PAGER_OFF, command.INVALID_ARG_VALUE, "pager : " + mode + ". Possible values : on/off/auto"
+}
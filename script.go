@@ -0,0 +1,283 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/parser/n1ql"
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* Control flow commands that can be used in script files. They
+   are handled by the Script, and not by ExecShellCmd.
+
+       \IF <expression>;
+           ...
+       \ELSE;
+           ...
+       \ENDIF;
+
+       \FOREACH $x IN <expression>;
+           ...
+       \END;
+
+   Expressions are N1QL expressions, and can refer to user defined
+   session variables as ${name}. The input of a \FOREACH is either
+   a statement in parentheses, whose results are used, or an
+   expression that evaluates to an array, such as ${ids}. The loop
+   variable is pushed for the duration of the loop and popped after
+   it.
+*/
+const (
+	IF_CMD      = "\\if"
+	ELSE_CMD    = "\\else"
+	ENDIF_CMD   = "\\endif"
+	FOREACH_CMD = "\\foreach"
+	END_CMD     = "\\end"
+)
+
+var foreachCmd = regexp.MustCompile(`(?is)^\\foreach\s+(\$[^\s]+)\s+in\s+(.+)$`)
+
+/* An \IF or \FOREACH block that has been entered. */
+type scriptBlock struct {
+	cmd    string
+	line   int
+	active bool
+	taken  bool
+	inElse bool
+}
+
+/* The body of a \FOREACH loop, which is collected until the
+   matching \END and then run once for every item.
+*/
+type scriptLoop struct {
+	vble   string
+	input  string
+	line   int
+	nested int
+	body   []Statement
+}
+
+/* A Script runs the statements read from a file or a pipe, one at
+   a time, and keeps track of the control flow blocks.
+*/
+type Script struct {
+	name   string
+	echo   bool
+	blocks []*scriptBlock
+	loop   *scriptLoop
+}
+
+func NewScript(name string, echo bool) *Script {
+	return &Script{name: name, echo: echo}
+}
+
+/* Execute the next statement in the script. */
+func (this *Script) Exec(stmt Statement) {
+	// The splitter only trims ASCII white space.
+	fields := strings.Fields(stmt.Text)
+	if len(fields) == 0 {
+		return
+	}
+	cmd := strings.ToLower(fields[0])
+
+	// Collect the body of a loop until its \END.
+	if this.loop != nil {
+		switch cmd {
+		case FOREACH_CMD:
+			this.loop.nested++
+		case END_CMD:
+			if this.loop.nested == 0 {
+				loop := this.loop
+				this.loop = nil
+				this.runLoop(loop)
+				return
+			}
+			this.loop.nested--
+		}
+		this.loop.body = append(this.loop.body, stmt)
+		return
+	}
+
+	active := this.active()
+
+	switch cmd {
+	case IF_CMD:
+		block := &scriptBlock{cmd: IF_CMD, line: stmt.Line}
+		if active {
+			this.echoStmt(stmt)
+			cond, err_code, err_str := evalExpr(strings.TrimSpace(stmt.Text[len(IF_CMD):]))
+			if err_code != 0 {
+				// Skip both branches if the condition cant be evaluated.
+				fileError(this.name, stmt.Line, err_code, err_str)
+				block.taken = true
+			} else {
+				block.active = cond.Truth()
+				block.taken = block.active
+			}
+		} else {
+			block.taken = true
+		}
+		this.blocks = append(this.blocks, block)
+
+	case ELSE_CMD, ENDIF_CMD:
+		n := len(this.blocks)
+		if n == 0 || this.blocks[n-1].cmd != IF_CMD {
+			fileError(this.name, stmt.Line, command.UNBALANCED_BLOCK, cmd+" without \\IF")
+			return
+		}
+		if cmd == ELSE_CMD {
+			block := this.blocks[n-1]
+			if block.inElse {
+				// Skip the rest of the block.
+				fileError(this.name, stmt.Line, command.UNBALANCED_BLOCK, cmd+" after \\ELSE")
+				block.active = false
+				return
+			}
+			block.inElse = true
+			block.active = !block.taken
+			block.taken = true
+		} else {
+			this.blocks = this.blocks[:n-1]
+		}
+
+	case FOREACH_CMD:
+		var m []string
+		if active {
+			m = foreachCmd.FindStringSubmatch(stmt.Text)
+			if m == nil {
+				fileError(this.name, stmt.Line, command.INVALID_EXPRESSION, ": "+stmt.Text)
+			}
+		}
+		if m == nil {
+			// Skip the loop, but still match its \END.
+			this.blocks = append(this.blocks, &scriptBlock{cmd: FOREACH_CMD, line: stmt.Line})
+			return
+		}
+		this.echoStmt(stmt)
+		this.loop = &scriptLoop{vble: m[1], input: strings.TrimSpace(m[2]), line: stmt.Line}
+
+	case END_CMD:
+		n := len(this.blocks)
+		if n == 0 || this.blocks[n-1].cmd != FOREACH_CMD {
+			fileError(this.name, stmt.Line, command.UNBALANCED_BLOCK, cmd+" without \\FOREACH")
+			return
+		}
+		this.blocks = this.blocks[:n-1]
+
+	default:
+		if active {
+			execFileStmt(stmt.Text, this.name, stmt.Line, this.echo)
+		}
+	}
+}
+
+/* Report the blocks that are still open at the end of the script. */
+func (this *Script) End() {
+	if this.loop != nil {
+		fileError(this.name, this.loop.line, command.UNBALANCED_BLOCK, "\\FOREACH without \\END")
+		this.loop = nil
+	}
+	for i := len(this.blocks) - 1; i >= 0; i-- {
+		block := this.blocks[i]
+		if block.cmd == IF_CMD {
+			fileError(this.name, block.line, command.UNBALANCED_BLOCK, "\\IF without \\ENDIF")
+		} else {
+			fileError(this.name, block.line, command.UNBALANCED_BLOCK, "\\FOREACH without \\END")
+		}
+	}
+	this.blocks = nil
+}
+
+/* Statements are only run if every enclosing block is active. */
+func (this *Script) active() bool {
+	for _, block := range this.blocks {
+		if !block.active {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *Script) echoStmt(stmt Statement) {
+	echoFileStmt(stmt.Text, this.name, stmt.Line, this.echo)
+}
+
+/* Run the body of the loop once for each item in its input. */
+func (this *Script) runLoop(loop *scriptLoop) {
+	var items value.Value
+	var err_code int
+	var err_str string
+
+	if strings.HasPrefix(loop.input, "(") && strings.HasSuffix(loop.input, ")") {
+		items, err_code, err_str = QueryResults(loop.input[1 : len(loop.input)-1])
+	} else {
+		items, err_code, err_str = evalExpr(loop.input)
+	}
+	if err_code != 0 {
+		fileError(this.name, loop.line, err_code, err_str)
+		return
+	}
+	if items.Type() != value.ARRAY {
+		fileError(this.name, loop.line, command.INVALID_EXPRESSION, ": "+loop.input+" is not an array")
+		return
+	}
+
+	// Push the variable for the first item, and set it after that.
+	pushed := false
+	for i := 0; ; i++ {
+		item, ok := items.Index(i)
+		if !ok {
+			break
+		}
+
+		err_code, err_str = command.PushOrSetValue(loop.vble, item, pushed)
+		if err_code != 0 {
+			fileError(this.name, loop.line, err_code, err_str)
+			break
+		}
+		pushed = true
+
+		body := NewScript(this.name, this.echo)
+		for _, stmt := range loop.body {
+			body.Exec(stmt)
+		}
+		body.End()
+	}
+
+	if pushed {
+		command.PopValue_Helper(false, command.UserDefSV, loop.vble[1:])
+	}
+}
+
+/* Evaluate a N1QL expression. References to user defined session
+   variables are replaced by their values first.
+*/
+func evalExpr(input string) (value.Value, int, string) {
+	input, err_code, err_str := Interpolate(input)
+	if err_code != 0 {
+		return nil, err_code, err_str
+	}
+
+	expr, err := n1ql.ParseExpression(input)
+	if err != nil {
+		return nil, command.INVALID_EXPRESSION, input + " : " + err.Error()
+	}
+
+	val, err := expr.Evaluate(value.NewValue(map[string]interface{}{}), expression.NewIndexContext())
+	if err != nil {
+		return nil, command.INVALID_EXPRESSION, input + " : " + err.Error()
+	}
+	return val, 0, ""
+}
@@ -0,0 +1,175 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbaselabs/go_cbq/command"
+)
+
+/* Formats for the session log given by -log-format. */
+const (
+	LOG_TEXT = "text"
+	LOG_JSON = "json"
+)
+
+const REDACTED = "****"
+
+/* A record in the session log. There is one record for every
+   statement or shell command that is executed.
+*/
+type LogRecord struct {
+	Timestamp string `json:"timestamp"`
+	Endpoint  string `json:"endpoint"`
+	Statement string `json:"statement"`
+	Duration  string `json:"duration"`
+	ErrorCode int    `json:"errorCode"`
+	Status    string `json:"status"`
+}
+
+var (
+	sessionLog    *os.File
+	sessionLogFmt string
+)
+
+/* Credentials given to -creds, whether to \SET or \PUSH or in the
+   body of an \ALIAS. The credentials run to the end of the
+   statement.
+*/
+var credsStmt = regexp.MustCompile(`(?i)(-creds)(\s+|=)\S.*$`)
+
+/* Open the session log given by -log-file. Records are appended,
+   so that one file can hold the log for several sessions. The
+   first record holds the command line the shell was started
+   with, with the values of the options hidden.
+*/
+func OpenSessionLog(path, format string) (int, string) {
+	format = strings.ToLower(format)
+	if format != LOG_TEXT && format != LOG_JSON {
+		return command.INVALID_ARG_VALUE, "-log-format : " + format
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+	sessionLog = f
+	sessionLogFmt = format
+
+	return writeLogRecord(strings.Join(redactArgs(os.Args), " "), time.Now(), 0, 0)
+}
+
+/* This method executes the input using execute_input, and then
+   records it in the session log, if there is one.
+*/
+func execute_logged(line string, w io.Writer) (int, string) {
+	start := time.Now()
+	err_code, err_str := execute_input(line, w)
+
+	if sessionLog != nil {
+		l_code, l_str := writeLogRecord(redactStmt(line), start, time.Since(start), err_code)
+		if l_code != 0 {
+			s_err := command.HandleError(l_code, l_str)
+			command.PrintError(s_err)
+		}
+	}
+	return err_code, err_str
+}
+
+func writeLogRecord(stmt string, start time.Time, duration time.Duration, err_code int) (int, string) {
+	status := "success"
+	if err_code != 0 {
+		status = "errors"
+	}
+
+	record := LogRecord{
+		Timestamp: start.Format(time.RFC3339Nano),
+		Endpoint:  ServerFlag,
+		Statement: stmt,
+		Duration:  duration.String(),
+		ErrorCode: err_code,
+		Status:    status,
+	}
+
+	var line string
+	if sessionLogFmt == LOG_JSON {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return errors.JSON_MARSHAL, err.Error()
+		}
+		line = string(b)
+	} else {
+		line = fmt.Sprintf("%s endpoint=%s duration=%s errorCode=%d status=%s statement=%q",
+			record.Timestamp, record.Endpoint, record.Duration, record.ErrorCode, record.Status, record.Statement)
+	}
+
+	_, werr := io.WriteString(sessionLog, line+"\n")
+	if werr != nil {
+		return errors.WRITE_FILE, werr.Error()
+	}
+	return 0, ""
+}
+
+/* Hide the credentials given to -creds anywhere in the statement,
+   such as \SET -creds or an \ALIAS that runs it.
+*/
+func redactStmt(line string) string {
+	return credsStmt.ReplaceAllString(line, "$1 "+REDACTED)
+}
+
+/* Hide the values of all the options, in either the -name=value
+   or the -name value form, since credentials can be given in
+   -credentials, in the statements of -script or in -var. Only the
+   names of the options are kept.
+*/
+func redactArgs(args []string) []string {
+	ret := make([]string, len(args))
+	if len(args) > 0 {
+		ret[0] = args[0]
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			ret[i] = REDACTED
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if eq := strings.Index(name, "="); eq >= 0 {
+			ret[i] = arg[:len(arg)-len(name)+eq] + "=" + REDACTED
+			continue
+		}
+
+		ret[i] = arg
+		if f := flag.Lookup(name); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			ret[i] = REDACTED
+		}
+	}
+	return ret
+}
+
+/* Return true if the option takes no value, as with -quiet. */
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,70 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactStmt(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{`select 1`, `select 1`},
+		{`\SET -creds user:pass`, `\SET -creds ****`},
+		{`\push -CREDS a:b, c:d`, `\push -CREDS ****`},
+		{`\SET -creds`, `\SET -creds`},
+		{`\SET -credsx 1`, `\SET -credsx 1`},
+		{`\ALIAS login \SET -creds user:pass`, `\ALIAS login \SET -creds ****`},
+		{`\SET -timeout 10s`, `\SET -timeout 10s`},
+	}
+
+	for _, test := range tests {
+		if got := redactStmt(test.line); got != test.expected {
+			t.Errorf("redactStmt(%q) = %q, expected %q", test.line, got, test.expected)
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			[]string{"cbq"},
+			[]string{"cbq"},
+		},
+		{
+			[]string{"cbq", "-c", "user:pass", "-engine=http://localhost:8093"},
+			[]string{"cbq", "-c", "****", "-engine=****"},
+		},
+		{
+			[]string{"cbq", "--credentials=user:pass", "-quiet", "-s", `\SET -creds u:p`},
+			[]string{"cbq", "--credentials=****", "-quiet", "-s", "****"},
+		},
+		{
+			[]string{"cbq", "-script=select 1", "-var", "password=secret", "-exit-on-error"},
+			[]string{"cbq", "-script=****", "-var", "****", "-exit-on-error"},
+		},
+		{
+			[]string{"cbq", "-quiet", "stray"},
+			[]string{"cbq", "-quiet", "****"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := redactArgs(test.args); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("redactArgs(%q) = %q, expected %q", test.args, got, test.expected)
+		}
+	}
+}
@@ -13,10 +13,10 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"golang.org/x/crypto/ssh/terminal"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/couchbase/query/errors"
 	"github.com/couchbaselabs/go_cbq/command"
@@ -105,7 +105,7 @@ var userFlag string
 func init() {
 	const (
 		defaultval = ""
-		usage      = "Username \n\t For Example : -u=Administrator"
+		usage      = "Username \n\t For Example : -u=Administrator \n\t If the input is not a terminal, the password is read from the CBQ_PASSWORD environment variable or /dev/tty."
 	)
 	flag.StringVar(&userFlag, "user", defaultval, usage)
 	flag.StringVar(&userFlag, "u", defaultval, " Shorthand for -user")
@@ -234,6 +234,70 @@ func init() {
 
 }
 
+/*
+   Option        : -log-format
+   Args          : text or json
+   Default value : text
+   Format of the records in the session log.
+*/
+
+var logFormatFlag string
+
+func init() {
+	const (
+		defaultval = LOG_TEXT
+		usage      = "Format of the session log given by -log-file. \n\t\t Default : text \n\t\t Possible Values : text/json"
+	)
+	flag.StringVar(&logFormatFlag, "log-format", defaultval, usage)
+
+}
+
+/*
+   Option        : -format
+   Args          : json, table, ascii, csv, tsv or ndjson
+   Default value : json
+   Output format for the results of statements.
+*/
+
+var formatFlag string
+
+func init() {
+	const (
+		defaultval = FORMAT_JSON
+		usage      = "Output format for the results of statements. Can be changed with \\SET format. \n\t\t Default : json \n\t\t Possible Values : json/table/ascii/csv/tsv/ndjson"
+	)
+	flag.StringVar(&formatFlag, "format", defaultval, usage)
+
+}
+
+/*
+   Option        : -var
+   Args          : <name>=<value>
+   Set a session variable before any statements are run. The
+   option can be given more than once.
+*/
+
+type varList []string
+
+func (this *varList) String() string {
+	return strings.Join(*this, ",")
+}
+
+func (this *varList) Set(val string) error {
+	*this = append(*this, val)
+	return nil
+}
+
+var varFlag varList
+
+func init() {
+	const (
+		usage = "Set a session variable. Can be given more than once. The name is a user defined session variable, with or without the $ prefix, or a named parameter with the -$ prefix. \n\t For Example : -var bucket=travel -var -$since=\"2024-01-01\""
+	)
+	flag.Var(&varFlag, "var", usage)
+
+}
+
 /* Define credentials as user/pass and convert into
    JSON object credentials
 */
@@ -249,6 +313,16 @@ func main() {
 	flag.Parse()
 	command.W = os.Stdout
 
+	/* When the standard input is not a terminal, the statements
+	   are read from it without a prompt or history.
+	*/
+	stdinMode := scriptFlag == "" && inputFlag == "" && !isTerminal(os.Stdin)
+
+	/* Colours are only used when the output is a terminal and
+	   NO_COLOR is not set.
+	*/
+	setColor(colorEnabled(os.Stdout))
+
 	/* Handle options and what they should do */
 
 	// TODO : Readd ...
@@ -275,7 +349,7 @@ func main() {
 
 	/* -quiet : Display Message only if flag not specified
 	 */
-	if !quietFlag && NoQueryService == false {
+	if !quietFlag && !stdinMode && !isDataFormat(formatFlag) && NoQueryService == false {
 		s := fmt.Sprintln("Connect to " + ServerFlag + ". Type Ctrl-D to exit.\n")
 		_, werr := io.WriteString(command.W, s)
 		if werr != nil {
@@ -300,25 +374,19 @@ func main() {
 	var creds command.Credentials
 
 	if userFlag != "" {
-		s := fmt.Sprintln("Enter Password: ")
-		_, werr := io.WriteString(command.W, s)
-		if werr != nil {
-			s_err := command.HandleError(errors.WRITER_OUTPUT, werr.Error())
-			command.PrintError(s_err)
-		}
-		password, err := terminal.ReadPassword(0)
-		if err == nil {
-			if string(password) == "" {
+		password, err_code, err_str := readPassword()
+		if err_code == 0 {
+			if password == "" {
 				s_err := command.HandleError(errors.INVALID_PASSWORD, "")
 				command.PrintError(s_err)
-				os.Exit(1)
+				os.Exit(EXIT_AUTH)
 			} else {
-				creds = append(creds, command.Credential{"user": userFlag, "pass": string(password)})
+				creds = append(creds, command.Credential{"user": userFlag, "pass": password})
 			}
 		} else {
-			s_err := command.HandleError(errors.INVALID_PASSWORD, err.Error())
+			s_err := command.HandleError(err_code, err_str)
 			command.PrintError(s_err)
-			os.Exit(1)
+			os.Exit(exitCode(err_code, err_str))
 		}
 	}
 
@@ -331,8 +399,8 @@ func main() {
 		// No credentials exist. This can still be used to connect to
 		// un-authenticated servers.
 		// Dont output the statement if we are running in single command
-		// mode.
-		if scriptFlag == "" {
+		// mode or reading from an input file or pipe.
+		if scriptFlag == "" && inputFlag == "" && !stdinMode {
 			_, werr := io.WriteString(command.W, "No Input Credentials. In order to connect to a server with authentication, please provide credentials.\n")
 
 			if werr != nil {
@@ -370,18 +438,74 @@ func main() {
 			//Error while Marshalling
 			s_err := command.HandleError(errors.JSON_MARSHAL, err.Error())
 			command.PrintError(s_err)
-			os.Exit(1)
+			os.Exit(EXIT_GENERAL)
 		}
 		go_n1ql.SetQueryParams("creds", string(ac))
 	}
 
-	if scriptFlag != "" {
-		go_n1ql.SetPassthroughMode(true)
-		err_code, err_str := execute_input(scriptFlag, os.Stdout)
+	/* -output : Send the statements and their results to the
+	   given file as well as os.Stdout.
+	*/
+	if outputFlag != "" {
+		err_code, err_str := SetOutputFile(outputFlag)
+		if err_code != 0 {
+			s_err := command.HandleError(err_code, err_str)
+			command.PrintError(s_err)
+			os.Exit(exitCode(err_code, err_str))
+		}
+	}
+
+	/* -log-file : Record every statement and shell command
+	   executed in the session.
+	*/
+	if logFlag != "" {
+		err_code, err_str := OpenSessionLog(logFlag, logFormatFlag)
+		if err_code != 0 {
+			s_err := command.HandleError(err_code, err_str)
+			command.PrintError(s_err)
+			if err_code == command.INVALID_ARG_VALUE {
+				// An unknown -log-format.
+				os.Exit(EXIT_USAGE)
+			}
+			os.Exit(exitCode(err_code, err_str))
+		}
+	}
+
+	/* -format : Set the format predefined session variable,
+	   after checking that the format exists.
+	*/
+	if _, err_code, err_str := GetFormatter(formatFlag, OUTPUT); err_code != 0 {
+		s_err := command.HandleError(err_code, err_str)
+		command.PrintError(s_err)
+		os.Exit(EXIT_USAGE)
+	}
+	if err_code, err_str := command.PushOrSet([]string{"format", "\"" + formatFlag + "\""}, true); err_code != 0 {
+		s_err := command.HandleError(err_code, err_str)
+		command.PrintError(s_err)
+		os.Exit(exitCode(err_code, err_str))
+	}
+
+	/* -var : Push the input values onto the session variable
+	   stacks. The values are resolved the same way as those
+	   given to \PUSH, so JSON numbers, objects and strings keep
+	   their types.
+	*/
+	for _, v := range varFlag {
+		err_code, err_str := pushVar(v)
 		if err_code != 0 {
 			s_err := command.HandleError(err_code, err_str)
 			command.PrintError(s_err)
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
+		}
+	}
+
+	if scriptFlag != "" {
+		go_n1ql.SetPassthroughMode(true)
+		echoStmt(scriptFlag)
+		err_code, err_str := execute_logged(scriptFlag, OUTPUT)
+		if err_code != 0 {
+			printExecError(err_code, err_str)
+			os.Exit(exitCode(err_code, err_str))
 		}
 		os.Exit(0)
 	}
@@ -392,10 +516,49 @@ func main() {
 
 	if inputFlag != "" {
 		//Read each line from the file and call execute query
-
+		go_n1ql.SetPassthroughMode(true)
+		err_code, err_str := ExecFile(inputFlag)
+		if err_code != 0 {
+			s_err := command.HandleError(err_code, err_str)
+			command.PrintError(s_err)
+			os.Exit(exitCode(err_code, err_str))
+		}
+		os.Exit(exitStatus)
 	}
 
 	go_n1ql.SetPassthroughMode(true)
+
+	if stdinMode {
+		err_code, err_str := ExecReader(os.Stdin, "<stdin>", false)
+		if err_code != 0 {
+			s_err := command.HandleError(err_code, err_str)
+			command.PrintError(s_err)
+			os.Exit(exitCode(err_code, err_str))
+		}
+		os.Exit(exitStatus)
+	}
+
 	//fmt.Println("Input arguments, ", os.Args)
 	HandleInteractiveMode(filepath.Base(os.Args[0]))
 }
+
+/* Push the value given by -var name=value onto the stack for the
+   variable. Names without a prefix are user defined session
+   variables.
+*/
+func pushVar(arg string) (int, string) {
+	eq := strings.Index(arg, "=")
+	if eq <= 0 {
+		return command.INVALID_ARG_VALUE, "-var : " + arg
+	}
+
+	name := strings.TrimSpace(arg[:eq])
+	if !strings.HasPrefix(name, "$") && !strings.HasPrefix(name, "-$") {
+		if strings.HasPrefix(name, "-") {
+			return command.INVALID_ARG_VALUE, "-var : " + arg
+		}
+		name = "$" + name
+	}
+
+	return command.PushOrSet([]string{name, arg[eq+1:]}, false)
+}
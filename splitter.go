@@ -0,0 +1,240 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"strings"
+)
+
+/* States of the statement splitter. SPLIT_LINE_COMMENT is never
+   kept as the state, since a line comment ends with its line.
+*/
+const (
+	SPLIT_NORMAL = iota
+	SPLIT_QUOTE
+	SPLIT_BLOCK_COMMENT
+	SPLIT_LINE_COMMENT
+)
+
+/* A complete statement, without its QRY_EOL, along with the line
+   of the input it starts on.
+*/
+type Statement struct {
+	Text string
+	Line int
+}
+
+/* The Splitter breaks shell input into statements. It is fed
+   one line at a time, and understands enough of N1QL to only
+   end a statement on a QRY_EOL that is outside string literals
+   ('...' and "..."), escaped identifiers (`...`) and comments.
+   Line comments start with -- anywhere in the input, or with #
+   at the start of a statement, and are dropped. Block comments
+   (/ * ... * /) inside a statement are kept in its text so that
+   they can still carry optimizer hints. Comments before the start
+   of a statement are dropped, so a statement made up of only
+   comments is never returned. A shell command, which starts with
+   a \, is not N1QL, so it ends at the first QRY_EOL or at the end
+   of its line, whatever quotes it holds, as in \ECHO it's;.
+*/
+type Splitter struct {
+	lex lexer
+
+	stmt       []rune
+	hasContent bool
+	shellCmd   bool
+
+	line     int
+	stmtLine int
+}
+
+func NewSplitter() *Splitter {
+	return &Splitter{}
+}
+
+/* Feed the next line of input to the splitter and return the
+   statements that it completes.
+*/
+func (this *Splitter) Feed(line string) []Statement {
+	var stmts []Statement
+
+	this.line++
+	line = strings.TrimRight(line, "\r\n")
+
+	if this.hasContent {
+		// Line breaks are only kept inside literals and comments.
+		if this.lex.state == SPLIT_NORMAL {
+			this.stmt = append(this.stmt, ' ')
+		} else {
+			this.stmt = append(this.stmt, '\n')
+		}
+	}
+
+	input := []rune(line)
+	for i, n := 0, 0; i < len(input); i += n {
+		if this.shellCmd {
+			n = 1
+			if string(input[i]) == QRY_EOL {
+				stmt, _ := this.next()
+				stmts = append(stmts, stmt)
+			} else {
+				this.addContent(input[i])
+			}
+			continue
+		}
+
+		var state int
+		n, state = this.lex.next(input, i, !this.hasContent)
+
+		switch state {
+		case SPLIT_QUOTE:
+			for _, c := range input[i : i+n] {
+				this.addContent(c)
+			}
+
+		case SPLIT_BLOCK_COMMENT:
+			for _, c := range input[i : i+n] {
+				this.addComment(c)
+			}
+
+		case SPLIT_LINE_COMMENT:
+			// Skip the rest of the line.
+
+		default:
+			c := input[i]
+			if string(c) == QRY_EOL {
+				if stmt, ok := this.next(); ok {
+					stmts = append(stmts, stmt)
+				}
+			} else if this.hasContent || !isSpace(c) {
+				if !this.hasContent && c == '\\' {
+					this.shellCmd = true
+				}
+				this.addContent(c)
+			}
+		}
+	}
+
+	// The end of the line ends a shell command.
+	if this.shellCmd {
+		stmt, _ := this.next()
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+}
+
+/* Return true if a statement has been partially entered, so
+   that the caller knows that more input is expected.
+*/
+func (this *Splitter) Pending() bool {
+	return this.hasContent || this.lex.state != SPLIT_NORMAL
+}
+
+/* Return the statement left unterminated at the end of the
+   input, if any.
+*/
+func (this *Splitter) Flush() (Statement, bool) {
+	this.lex = lexer{}
+	return this.next()
+}
+
+func (this *Splitter) addContent(c rune) {
+	if !this.hasContent {
+		this.hasContent = true
+		this.stmtLine = this.line
+	}
+	this.stmt = append(this.stmt, c)
+}
+
+/* Block comments are only kept once the statement has started. */
+func (this *Splitter) addComment(c rune) {
+	if this.hasContent {
+		this.stmt = append(this.stmt, c)
+	}
+}
+
+/* Reset the splitter for the next statement, and return the
+   current one if it has anything other than comments in it.
+*/
+func (this *Splitter) next() (Statement, bool) {
+	stmt := Statement{
+		Text: strings.TrimSpace(string(this.stmt)),
+		Line: this.stmtLine,
+	}
+	ok := this.hasContent
+
+	this.stmt = this.stmt[:0]
+	this.hasContent = false
+	this.shellCmd = false
+	return stmt, ok
+}
+
+/* A lexer finds the string literals ('...' and "..."), escaped
+   identifiers (`...`) and comments in N1QL text, so that they
+   can be treated differently from the rest of it. Its state is
+   kept from one call to the next, so the text can be given a
+   line at a time.
+*/
+type lexer struct {
+	state   int
+	quote   rune
+	escaped bool
+}
+
+/* Return the number of runes taken up by the text at input[i],
+   and the state that they are in. Only a literal or a comment
+   takes up more than one rune at a time : the opening or closing
+   characters of a block comment, or the rest of the line for a
+   line comment. A # only starts a line comment if hash is true.
+*/
+func (this *lexer) next(input []rune, i int, hash bool) (int, int) {
+	c := input[i]
+
+	switch this.state {
+
+	case SPLIT_QUOTE:
+		if this.escaped {
+			this.escaped = false
+		} else if c == '\\' {
+			this.escaped = true
+		} else if c == this.quote {
+			this.state = SPLIT_NORMAL
+		}
+		return 1, SPLIT_QUOTE
+
+	case SPLIT_BLOCK_COMMENT:
+		if c == '*' && i+1 < len(input) && input[i+1] == '/' {
+			this.state = SPLIT_NORMAL
+			return 2, SPLIT_BLOCK_COMMENT
+		}
+		return 1, SPLIT_BLOCK_COMMENT
+	}
+
+	switch {
+	case c == '\'' || c == '"' || c == '`':
+		this.state = SPLIT_QUOTE
+		this.quote = c
+		return 1, SPLIT_QUOTE
+
+	case c == '/' && i+1 < len(input) && input[i+1] == '*':
+		this.state = SPLIT_BLOCK_COMMENT
+		return 2, SPLIT_BLOCK_COMMENT
+
+	case c == '-' && i+1 < len(input) && input[i+1] == '-',
+		c == '#' && hash:
+		return len(input) - i, SPLIT_LINE_COMMENT
+	}
+	return 1, SPLIT_NORMAL
+}
+
+func isSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
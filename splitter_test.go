@@ -0,0 +1,126 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitter(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		stmts []Statement
+		flush *Statement
+	}{
+		{
+			name:  "one statement",
+			lines: []string{"select 1;"},
+			stmts: []Statement{{"select 1", 1}},
+		},
+		{
+			name:  "several statements on a line",
+			lines: []string{`\\cmd2;\\cmd;select 1 ;`},
+			stmts: []Statement{{`\\cmd2`, 1}, {`\\cmd`, 1}, {"select 1", 1}},
+		},
+		{
+			name:  "statement over several lines",
+			lines: []string{"select a", "  from b", "where c = 1;"},
+			stmts: []Statement{{"select a   from b where c = 1", 1}},
+		},
+		{
+			name:  "semicolon in literals and identifiers",
+			lines: []string{`select 'a;b', "c;d", ` + "`e;f`" + ` from g;`},
+			stmts: []Statement{{`select 'a;b', "c;d", ` + "`e;f`" + ` from g`, 1}},
+		},
+		{
+			name:  "escaped quote",
+			lines: []string{`select 'it\'s;' from b;`},
+			stmts: []Statement{{`select 'it\'s;' from b`, 1}},
+		},
+		{
+			name:  "literal over several lines keeps the line break",
+			lines: []string{"select 'a", "b';"},
+			stmts: []Statement{{"select 'a\nb'", 1}},
+		},
+		{
+			name:  "line comments are dropped",
+			lines: []string{"-- first;", "# second;", "select 1 -- third;", ";"},
+			stmts: []Statement{{"select 1", 3}},
+		},
+		{
+			name:  "hash inside a statement is kept",
+			lines: []string{"select 1 # 2;"},
+			stmts: []Statement{{"select 1 # 2", 1}},
+		},
+		{
+			name:  "block comment inside a statement is kept",
+			lines: []string{"select /*+ hint; */ 1;"},
+			stmts: []Statement{{"select /*+ hint; */ 1", 1}},
+		},
+		{
+			name:  "block comment before a statement is dropped",
+			lines: []string{"/* a;", "b; */ select 1;"},
+			stmts: []Statement{{"select 1", 2}},
+		},
+		{
+			name:  "comments only",
+			lines: []string{"/* a */;", "-- b", ";"},
+		},
+		{
+			name:  "quotes in a shell command",
+			lines: []string{`\ECHO it's;`, "select 'a;b';"},
+			stmts: []Statement{{`\ECHO it's`, 1}, {"select 'a;b'", 2}},
+		},
+		{
+			name:  "shell command ends with its line",
+			lines: []string{`  \ECHO "a`, "select 1;"},
+			stmts: []Statement{{`\ECHO "a`, 1}, {"select 1", 2}},
+		},
+		{
+			name:  "shell commands and a statement on a line",
+			lines: []string{`\ECHO a; \ECHO 'b; select 1;`},
+			stmts: []Statement{{`\ECHO a`, 1}, {`\ECHO 'b`, 1}, {"select 1", 1}},
+		},
+		{
+			name:  "unterminated statement is flushed",
+			lines: []string{"select 1;", "select", "2"},
+			stmts: []Statement{{"select 1", 1}},
+			flush: &Statement{"select 2", 2},
+		},
+		{
+			name:  "unterminated literal is flushed",
+			lines: []string{"select 'a;"},
+			flush: &Statement{"select 'a;", 1},
+		},
+	}
+
+	for _, test := range tests {
+		splitter := NewSplitter()
+		var stmts []Statement
+		for _, line := range test.lines {
+			stmts = append(stmts, splitter.Feed(line+"\n")...)
+		}
+		if !reflect.DeepEqual(stmts, test.stmts) {
+			t.Errorf("%s : got %q, expected %q", test.name, stmts, test.stmts)
+		}
+
+		if pending := splitter.Pending(); pending != (test.flush != nil) {
+			t.Errorf("%s : Pending() = %v", test.name, pending)
+		}
+		stmt, ok := splitter.Flush()
+		if test.flush == nil && ok {
+			t.Errorf("%s : unexpected flush %q", test.name, stmt)
+		} else if test.flush != nil && (!ok || stmt != *test.flush) {
+			t.Errorf("%s : flushed %q, %v, expected %q", test.name, stmt, ok, *test.flush)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/mattn/go-runewidth"
+)
+
+/* Column used for results that are not objects, such as the
+   results of SELECT RAW.
+*/
+const VALUE_COLUMN = "value"
+
+/* Columns are never truncated to less than this width. */
+const MIN_COLUMN_WIDTH = 5
+
+/* Characters used to draw the borders of a table. */
+type tableStyle struct {
+	h, v       string
+	tl, tm, tr string
+	ml, mm, mr string
+	bl, bm, br string
+	ellipsis   string
+}
+
+var unicodeStyle = tableStyle{
+	h: "─", v: "│",
+	tl: "┌", tm: "┬", tr: "┐",
+	ml: "├", mm: "┼", mr: "┤",
+	bl: "└", bm: "┴", br: "┘",
+	ellipsis: "…",
+}
+
+var asciiStyle = tableStyle{
+	h: "-", v: "|",
+	tl: "+", tm: "+", tr: "+",
+	ml: "+", mm: "+", mr: "+",
+	bl: "+", bm: "+", br: "+",
+	ellipsis: "...",
+}
+
+var cellReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+/* The table formatter prints the results as a table with a
+   column for each field in the signature. If the signature has
+   a * or the results are not objects, the columns are taken from
+   the fields of the results instead. The rows are kept until the
+   end of the results so that the columns can be aligned. Strings
+   are printed without quotes and other values as JSON. If the
+   output is a terminal the widest columns are truncated so that
+   the table fits its width. Fields that are MISSING from a row
+   are shown by the marker given by the missing predefined session
+   variable, which is empty by default, and NULL values as null.
+*/
+type TableFormatter struct {
+	w     io.Writer
+	style tableStyle
+
+	columns []string
+	seen    map[string]bool
+
+	rows     [][]string
+	status   string
+	missing  string
+	messages []string
+}
+
+func NewTableFormatter(w io.Writer) Formatter {
+	return &TableFormatter{w: w, style: unicodeStyle, seen: map[string]bool{}, missing: currentMissing()}
+}
+
+func NewASCIIFormatter(w io.Writer) Formatter {
+	return &TableFormatter{w: w, style: asciiStyle, seen: map[string]bool{}, missing: currentMissing()}
+}
+
+func (this *TableFormatter) Header(requestID string, signature json.RawMessage) (int, string) {
+	this.columns = signatureColumns(signature)
+	for _, name := range this.columns {
+		this.seen[name] = true
+	}
+	return 0, ""
+}
+
+/* Keep the cells of the row. The cells are stored by column
+   name until End, because new columns can still be found.
+   Fields that are not in the signature are added as columns
+   after those that are, in the order they are found.
+*/
+func (this *TableFormatter) Row(row []byte) (int, string) {
+	names, fields, err_code, err_str := rowFields(row)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+
+	cells := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		if !this.seen[name] {
+			this.seen[name] = true
+			this.columns = append(this.columns, name)
+		}
+		cells = append(cells, name, cellText(fields[name]))
+	}
+	this.rows = append(this.rows, cells)
+	return 0, ""
+}
+
+/* The errors and warnings are listed after the table. */
+func (this *TableFormatter) Messages(errs, warnings json.RawMessage) (int, string) {
+	this.messages = messageLines(errs, warnings)
+	return 0, ""
+}
+
+func (this *TableFormatter) Status(status string) (int, string) {
+	this.status = status
+	return 0, ""
+}
+
+/* The metrics are not printed with the table. */
+func (this *TableFormatter) Metrics(metrics []byte) (int, string) {
+	return 0, ""
+}
+
+func (this *TableFormatter) End() (int, string) {
+	var buf bytes.Buffer
+
+	if len(this.columns) > 0 {
+		missing := cellReplacer.Replace(this.missing)
+		index := make(map[string]int, len(this.columns))
+		widths := make([]int, len(this.columns))
+		for i, name := range this.columns {
+			index[name] = i
+			widths[i] = runewidth.StringWidth(name)
+		}
+
+		// Place the cells of each row in the order of the columns.
+		table := make([][]string, len(this.rows))
+		for r, cells := range this.rows {
+			table[r] = make([]string, len(this.columns))
+			for c, _ := range table[r] {
+				table[r][c] = missing
+			}
+			for i := 0; i < len(cells); i += 2 {
+				table[r][index[cells[i]]] = cells[i+1]
+			}
+			for c, cell := range table[r] {
+				if width := runewidth.StringWidth(cell); width > widths[c] {
+					widths[c] = width
+				}
+			}
+		}
+
+		this.fit(widths, terminalWidth(this.w))
+
+		this.border(&buf, widths, this.style.tl, this.style.tm, this.style.tr)
+		this.line(&buf, widths, this.columns)
+		this.border(&buf, widths, this.style.ml, this.style.mm, this.style.mr)
+		for _, cells := range table {
+			this.line(&buf, widths, cells)
+		}
+		this.border(&buf, widths, this.style.bl, this.style.bm, this.style.br)
+	}
+
+	buf.WriteString(rowCount(len(this.rows)))
+	if this.status != "" && this.status != "success" {
+		buf.WriteString(" (" + this.status + ")")
+	}
+	buf.WriteString("\n")
+	for _, line := range this.messages {
+		buf.WriteString(line + "\n")
+	}
+
+	_, werr := io.WriteString(this.w, buf.String())
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
+
+/* Narrow the widest columns until the table fits the terminal. */
+func (this *TableFormatter) fit(widths []int, termWidth int) {
+	if termWidth <= 0 {
+		return
+	}
+
+	// Each column has a border and a space on either side.
+	total := 1
+	for _, width := range widths {
+		total += width + 3
+	}
+
+	for total > termWidth {
+		widest := 0
+		for i, width := range widths {
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= MIN_COLUMN_WIDTH {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+func (this *TableFormatter) border(buf *bytes.Buffer, widths []int, left, middle, right string) {
+	buf.WriteString(left)
+	for i, width := range widths {
+		if i > 0 {
+			buf.WriteString(middle)
+		}
+		buf.WriteString(strings.Repeat(this.style.h, width+2))
+	}
+	buf.WriteString(right + "\n")
+}
+
+func (this *TableFormatter) line(buf *bytes.Buffer, widths []int, cells []string) {
+	buf.WriteString(this.style.v)
+	for i, width := range widths {
+		cell := cells[i]
+		if runewidth.StringWidth(cell) > width {
+			cell = runewidth.Truncate(cell, width, this.style.ellipsis)
+		}
+		buf.WriteString(" " + cell + strings.Repeat(" ", width-runewidth.StringWidth(cell)) + " ")
+		buf.WriteString(this.style.v)
+	}
+	buf.WriteString("\n")
+}
+
+/* Return the names of the fields of a result, in order, and
+   their values. A result that is not an object is returned as the
+   single field VALUE_COLUMN.
+*/
+func rowFields(row []byte) ([]string, map[string]json.RawMessage, int, string) {
+	trimmed := bytes.TrimSpace(row)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return []string{VALUE_COLUMN}, map[string]json.RawMessage{VALUE_COLUMN: json.RawMessage(trimmed)}, 0, ""
+	}
+
+	names, fields, ok := decodeObject(trimmed)
+	if !ok {
+		return nil, nil, errors.JSON_UNMARSHAL, "Invalid result : " + string(trimmed)
+	}
+	return names, fields, 0, ""
+}
+
+/* Return the text of a value in a single line. */
+func cellText(val json.RawMessage) string {
+	return cellReplacer.Replace(valueText(val))
+}
+
+/* Return the text of a value. Strings are returned without
+   quotes, and other values, including null, as compact JSON.
+*/
+func valueText(val json.RawMessage) string {
+	if string(bytes.TrimSpace(val)) == "null" {
+		return "null"
+	}
+
+	var s string
+	if err := json.Unmarshal(val, &s); err == nil {
+		return s
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, val); err != nil {
+		return string(val)
+	}
+	return buf.String()
+}
+
+func rowCount(n int) string {
+	if n == 1 {
+		return "1 row"
+	}
+	return strconv.Itoa(n) + " rows"
+}
@@ -0,0 +1,96 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbaselabs/go_cbq/command"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+/* Environment variable used to pass the password for -user when
+   the standard input is not a terminal.
+*/
+const PASSWORD_ENV = "CBQ_PASSWORD"
+
+/* Return true if the file is a terminal. */
+func isTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+/* Return the width of the terminal that w writes to, or 0 if w
+   is not a terminal.
+*/
+func terminalWidth(w io.Writer) int {
+	width, _ := terminalSize(w)
+	return width
+}
+
+/* Return the width and height of the terminal that w writes to,
+   or 0, 0 if w is not a terminal. The output of a Pager is that
+   of the writer it pages.
+*/
+func terminalSize(w io.Writer) (int, int) {
+	if pager, ok := w.(*Pager); ok {
+		w = pager.w
+	}
+	f, ok := w.(*os.File)
+	if !ok || !isTerminal(f) {
+		return 0, 0
+	}
+	width, height, err := terminal.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0, 0
+	}
+	return width, height
+}
+
+/* Read the password for -user. If the standard input is a terminal
+   the password is read from it. Otherwise, for example when
+   statements are piped into the shell, the standard input holds
+   the statements, and so the password is taken from the
+   CBQ_PASSWORD environment variable, or read from the controlling
+   terminal (/dev/tty) if it is not set.
+*/
+func readPassword() (string, int, string) {
+	if isTerminal(os.Stdin) {
+		_, werr := io.WriteString(command.W, "Enter Password: \n")
+		if werr != nil {
+			s_err := command.HandleError(errors.WRITER_OUTPUT, werr.Error())
+			command.PrintError(s_err)
+		}
+
+		password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return "", errors.INVALID_PASSWORD, err.Error()
+		}
+		return string(password), 0, ""
+	}
+
+	if password, ok := os.LookupEnv(PASSWORD_ENV); ok {
+		return password, 0, ""
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errors.INVALID_PASSWORD, "Set " + PASSWORD_ENV + " when the input is not a terminal. " + err.Error()
+	}
+	defer tty.Close()
+
+	io.WriteString(tty, "Enter Password: \n")
+	password, err := terminal.ReadPassword(int(tty.Fd()))
+	if err != nil {
+		return "", errors.INVALID_PASSWORD, err.Error()
+	}
+	return string(password), 0, ""
+}
@@ -0,0 +1,258 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/query/value"
+	"github.com/couchbaselabs/go_cbq/command"
+	go_n1ql "github.com/couchbaselabs/go_n1ql"
+)
+
+/* Values of the metrics predefined session variable. full writes
+   the metrics returned by the server with the results, footer
+   writes a one line summary after them, and off writes neither.
+*/
+const (
+	METRICS_FULL   = "full"
+	METRICS_FOOTER = "footer"
+	METRICS_OFF    = "off"
+)
+
+/* Return the metrics mode, given by the metrics predefined
+   session variable.
+*/
+func currentMetrics() (string, int, string) {
+	v, err_code, _ := command.PreDefSV["metrics"].Top()
+	if err_code != 0 {
+		return METRICS_FULL, 0, ""
+	}
+
+	mode := command.ValToStr(v)
+	if v.Type() == value.STRING {
+		mode = v.Actual().(string)
+	} else if v.Type() == value.BOOLEAN {
+		// \SET metrics true and false
+		if v.Truth() {
+			mode = METRICS_FULL
+		} else {
+			mode = METRICS_OFF
+		}
+	}
+
+	switch strings.ToLower(mode) {
+	case METRICS_FULL, METRICS_FOOTER, METRICS_OFF:
+		return strings.ToLower(mode), 0, ""
+	}
+	return METRICS_FULL, command.INVALID_ARG_VALUE, "metrics : " + mode + ". Possible values : full/footer/off"
+}
+
+/* Return true if the client side timings should be written
+   after the results, given by the timing predefined session
+   variable. It can be set to on/off or true/false.
+*/
+func currentTiming() (bool, int, string) {
+	v, err_code, _ := command.PreDefSV["timing"].Top()
+	if err_code != 0 {
+		return false, 0, ""
+	}
+
+	if v.Type() == value.BOOLEAN {
+		return v.Truth(), 0, ""
+	}
+
+	mode := command.ValToStr(v)
+	if v.Type() == value.STRING {
+		mode = v.Actual().(string)
+	}
+
+	switch strings.ToLower(mode) {
+	case "on":
+		return true, 0, ""
+	case "off":
+		return false, 0, ""
+	}
+	return false, command.INVALID_ARG_VALUE, "timing : " + mode + ". Possible values : on/off"
+}
+
+/* The times measured by the shell while running a statement : the
+   time from sending the statement until the query service starts
+   its response, and until the last result has been read. go_n1ql
+   reads the whole response before it returns the first row, so
+   the time to the first row is not measured; the start of the
+   response is the closest to it that can be seen.
+*/
+type Timing struct {
+	start time.Time
+	first time.Duration
+	total time.Duration
+}
+
+/* The statement being timed, whose first time is set by the
+   transport of the go_n1ql client.
+*/
+var activeTiming *Timing
+var activeTimingLock sync.Mutex
+
+func StartTiming() *Timing {
+	this := &Timing{start: time.Now()}
+	activeTimingLock.Lock()
+	activeTiming = this
+	activeTimingLock.Unlock()
+	return this
+}
+
+/* Record that the last result has been read. */
+func (this *Timing) Done() {
+	this.total = time.Since(this.start)
+	activeTimingLock.Lock()
+	if activeTiming == this {
+		activeTiming = nil
+	}
+	activeTimingLock.Unlock()
+}
+
+/* Return the client side timings, such as
+   first byte 12.1ms, round trip 34.2ms, 350.9 rows/sec
+   The rate is over the round trip, and so includes the time the
+   server took to start its response, since the response is read
+   in full before the results are returned to the shell.
+*/
+func (this *Timing) String(rows int) string {
+	rate := 0.0
+	if this.total > 0 {
+		rate = float64(rows) / this.total.Seconds()
+	}
+
+	text := fmt.Sprintf("round trip %s, %.1f rows/sec", formatDuration(this.total), rate)
+	if this.first > 0 {
+		text = "first byte " + formatDuration(this.first) + ", " + text
+	}
+	return text
+}
+
+/* timedTransport wraps the transport of the go_n1ql client, and
+   records when the response headers of each request arrive for
+   the statement being timed. RoundTrip returns before the body is
+   read, so this is the time until the query service started its
+   response. The last request made for the statement is the one
+   that runs it, so each request replaces the time of the one
+   before, such as that made to find the query service when
+   connecting to a cluster.
+*/
+type timedTransport struct {
+	base http.RoundTripper
+}
+
+func init() {
+	base := go_n1ql.HTTPClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	go_n1ql.HTTPClient.Transport = &timedTransport{base: base}
+}
+
+func (this *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := this.base.RoundTrip(req)
+
+	activeTimingLock.Lock()
+	if activeTiming != nil {
+		activeTiming.first = time.Since(activeTiming.start)
+	}
+	activeTimingLock.Unlock()
+	return resp, err
+}
+
+/* Return the one line summary of a statement, such as
+   12 rows in 34.2ms (server 30.1ms)
+   The server time is the elapsedTime of the metrics, and is left
+   out if the server didnt return it.
+*/
+func (this *Timing) Footer(rows int, metrics []byte) string {
+	footer := rowCount(rows) + " in " + formatDuration(this.total)
+	if elapsed, ok := serverElapsed(metrics); ok {
+		footer += " (server " + formatDuration(elapsed) + ")"
+	}
+	return footer
+}
+
+/* Write the footer and the client side timings that follow the
+   results, if they are turned on.
+*/
+func writeTimingNotes(w io.Writer, timing *Timing, rows int, metrics []byte, metricsMode string, timingOn bool) error {
+	var notes []string
+	if metricsMode == METRICS_FOOTER {
+		notes = append(notes, timing.Footer(rows, metrics))
+	}
+	if timingOn {
+		notes = append(notes, timing.String(rows))
+	}
+	for _, text := range notes {
+		if _, err := io.WriteString(w, text+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* Return the elapsedTime from the metrics returned by the server. */
+func serverElapsed(metrics []byte) (time.Duration, bool) {
+	if metrics == nil {
+		return 0, false
+	}
+
+	var dat struct {
+		ElapsedTime string `json:"elapsedTime"`
+	}
+	if err := json.Unmarshal(metrics, &dat); err != nil || dat.ElapsedTime == "" {
+		return 0, false
+	}
+
+	elapsed, err := time.ParseDuration(dat.ElapsedTime)
+	if err != nil {
+		return 0, false
+	}
+	return elapsed, true
+}
+
+/* Format a duration with one decimal place, in the largest unit
+   that keeps it above 1.
+*/
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.1fµs", float64(d)/float64(time.Microsecond))
+	}
+}
+
+/* Return the writer for the notes that follow the results, such
+   as the timings. They are written to os.Stderr for the data
+   formats, so that the output only holds the results.
+*/
+func noteWriter(w io.Writer) io.Writer {
+	if isDataFormat(currentFormat()) {
+		return os.Stderr
+	}
+	return w
+}
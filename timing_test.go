@@ -0,0 +1,56 @@
+//  Copyright (c) 2015-2016 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"results":[]}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &timedTransport{base: http.DefaultTransport}}
+	timing := StartTiming()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := timing.first
+	resp.Body.Close()
+	timing.Done()
+
+	if first < 20*time.Millisecond || first >= timing.total {
+		t.Errorf("first byte %v, round trip %v", first, timing.total)
+	}
+	if text := timing.String(0); !strings.HasPrefix(text, "first byte ") {
+		t.Errorf("String() = %q", text)
+	}
+
+	// Requests made once the statement is done are not timed.
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if timing.first != first {
+		t.Errorf("first byte changed to %v after Done", timing.first)
+	}
+}